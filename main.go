@@ -6,18 +6,24 @@ import (
 	"os"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/joho/godotenv"
 	"github.com/x1xo/Auth/src/databases"
+	"github.com/x1xo/Auth/src/providers"
 	"github.com/x1xo/Auth/src/routes"
 	callbackRoutes "github.com/x1xo/Auth/src/routes/callback"
+	"github.com/x1xo/Auth/src/utils"
 )
 
 func main() {
 	godotenv.Load()
 	go databases.GetRedis()
 	databases.GetMongo()
+	if err := databases.Migrate(); err != nil {
+		log.Fatal("[Databases] Couldn't migrate: ", err)
+	}
+	providers.Load()
+	go utils.PurgeDeletedUsers()
 
 	app := fiber.New(fiber.Config{
 		ProxyHeader:             "X-Forwarded-For",
@@ -25,27 +31,66 @@ func main() {
 	})
 	app.Use(logger.New())
 
-	app.Use(cors.New(cors.Config{
-		AllowHeaders:     "Origin,Content-Type,Accept,Content-Length,Accept-Language,Accept-Encoding,Connection,Access-Control-Allow-Origin",
-		AllowCredentials: true,
-		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
-		AllowOrigins:     os.Getenv("ALLOWED_ORIGINS"),
-	}))
+	app.Use(utils.CORS())
 
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.SendString("Identity provider by x1xo. All rights reserved.")
 	})
 
 	app.Get("/api/user", routes.GetUser)
+	app.Delete("/api/user", utils.RequireSession, routes.DeleteUser)
+	app.Get("/api/user/export", utils.RequireSession, routes.ExportUser)
+	app.Post("/api/user/token", utils.RequireSession, routes.IssueAccessToken)
+	app.Post("/api/user/deletion/cancel", utils.RequireSession, routes.CancelUserDeletion)
 	app.Get("/api/user/sessions", routes.GetUserSessions)
 	app.Delete("/api/user/sessions/invalidate_all", routes.InvalidateAllSessions)
 	app.Delete("/api/user/sessions/:sessionId", routes.InvalidateSession)
+	app.Post("/api/user/email/verify", utils.RequireSession, routes.SendEmailVerification)
+	app.Get("/api/user/email/verify/confirm", routes.ConfirmEmailVerification)
+	app.Post("/api/user/mfa/totp", utils.RequireSession, routes.EnrollTOTP)
+	app.Post("/api/user/mfa/totp/confirm", utils.RequireSession, routes.ConfirmTOTP)
+	app.Delete("/api/user/mfa/totp", utils.RequireSession, routes.DisableTOTP)
+	app.Post("/api/user/mfa/recovery_codes", utils.RequireSession, routes.RegenerateRecoveryCodes)
+	app.Post("/api/user/mfa/passkey/begin", utils.RequireSession, routes.BeginPasskeyReauth)
+	app.Post("/api/user/mfa/passkey/finish", utils.RequireSession, routes.FinishPasskeyReauth)
+	app.Delete("/api/user/providers/:provider", utils.RequireSession, routes.UnlinkProvider)
+	app.Get("/api/user/passkeys", utils.RequireSession, routes.GetPasskeys)
+	app.Post("/api/user/passkeys/register/begin", utils.RequireSession, routes.BeginPasskeyRegistration)
+	app.Post("/api/user/passkeys/register/finish", utils.RequireSession, routes.FinishPasskeyRegistration)
+	app.Delete("/api/user/passkeys/:passkeyId", utils.RequireSession, routes.DeletePasskey)
+
+	app.Get("/api/admin/clients", utils.RequireAdmin, routes.GetClients)
+	app.Post("/api/admin/clients", utils.RequireAdmin, routes.CreateClient)
+	app.Get("/api/admin/clients/:clientId", utils.RequireAdmin, routes.GetClient)
+	app.Put("/api/admin/clients/:clientId", utils.RequireAdmin, routes.UpdateClient)
+	app.Post("/api/admin/clients/:clientId/secret", utils.RequireAdmin, routes.RotateClientSecret)
+	app.Delete("/api/admin/clients/:clientId", utils.RequireAdmin, routes.DeleteClient)
+	app.Put("/api/admin/users/:userId/roles", utils.RequireAdmin, routes.SetUserRoles)
 
 	app.Get("/login", routes.Login)
+	app.Post("/login/password", routes.PasswordLogin)
+	app.Post("/login/email", routes.MagicLinkLogin)
+	app.Get("/login/email/verify", routes.MagicLinkConfirm)
+	app.Post("/login/email/verify", routes.MagicLinkVerify)
+
+	app.Post("/login/passkey/begin", routes.BeginPasskeyLogin)
+	app.Post("/login/passkey/finish", routes.FinishPasskeyLogin)
+
+	app.Post("/mfa/verify", routes.VerifyMFA)
+	app.Post("/mfa/passkey/begin", routes.BeginPasskeyMFA)
+	app.Post("/mfa/passkey/finish", routes.FinishPasskeyMFA)
+	app.Post("/register", routes.Register)
+
+	app.Get("/.well-known/openid-configuration", routes.OpenIDConfiguration)
+	app.Get("/jwks.json", routes.JWKS)
+	app.Get("/authorize", routes.Authorize)
+	app.Post("/token", routes.Token)
+	app.Get("/userinfo", routes.UserInfo)
+	app.Post("/userinfo", routes.UserInfo)
+	app.Post("/introspect", routes.Introspect)
 
-	app.Get("/callback/github", callbackRoutes.CallbackGithub)
-	app.Get("/callback/discord", callbackRoutes.CallbackDiscord)
-	app.Get("/callback/google", callbackRoutes.CallbackGoogle)
+	app.Get("/callback/:provider", callbackRoutes.Callback)
+	app.Post("/callback/:provider", callbackRoutes.Callback)
 
 	environment := os.Getenv("ENVIRONMENT")
 	port := os.Getenv("PORT")
@@ -0,0 +1,145 @@
+package databases
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// legacyUser is a user saved before the identities list, with a fixed document per provider
+type legacyUser struct {
+	Id        string    `bson:"id"`
+	Email     string    `bson:"email"`
+	UpdatedAt time.Time `bson:"updated_at"`
+	Github    bson.M    `bson:"github"`
+	Discord   bson.M    `bson:"discord"`
+	Google    bson.M    `bson:"google"`
+	Gitlab    bson.M    `bson:"gitlab"`
+}
+
+// Migrate updates the documents saved by older versions, it's safe to run on every start
+func Migrate() error {
+	users := GetMongoDatabase().Collection("users")
+
+	_, err := users.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject_id", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Users without an email (some providers don't share it) are left out of the unique index
+	_, err = users.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"email": bson.M{"$gt": ""}}),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := lowercaseEmails(users); err != nil {
+		return err
+	}
+
+	_, err = GetMongoDatabase().Collection("clients").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	cursor, err := users.Find(context.Background(), bson.M{"identities": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	migrated := 0
+	for cursor.Next(context.Background()) {
+		var user legacyUser
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+
+		identities := []Identity{}
+		// GitHub users were saved without their id, it's added on the next login
+		if username, _ := user.Github["username"].(string); username != "" {
+			identities = append(identities, legacyIdentity("github", "", user.Email, user.UpdatedAt, user.Github))
+		}
+		if id, _ := user.Discord["id"].(string); id != "" {
+			email, _ := user.Discord["email"].(string)
+			identities = append(identities, legacyIdentity("discord", id, email, user.UpdatedAt, user.Discord))
+		}
+		if id, _ := user.Google["id"].(string); id != "" {
+			email, _ := user.Google["email"].(string)
+			identities = append(identities, legacyIdentity("google", id, email, user.UpdatedAt, user.Google))
+		}
+		if id, _ := user.Gitlab["id"].(int64); id != 0 {
+			email, _ := user.Gitlab["email"].(string)
+			identities = append(identities, legacyIdentity("gitlab", strconv.FormatInt(id, 10), email, user.UpdatedAt, user.Gitlab))
+		}
+
+		_, err := users.UpdateOne(context.Background(), bson.M{"id": user.Id}, bson.M{
+			"$set":   bson.M{"identities": identities},
+			"$unset": bson.M{"github": "", "discord": "", "google": "", "gitlab": ""},
+		})
+		if err != nil {
+			return err
+		}
+		migrated++
+	}
+
+	if migrated > 0 {
+		fmt.Printf("[Databases] Migrated %d users to identities\n", migrated)
+	}
+
+	return cursor.Err()
+}
+
+// lowercaseEmails lowercases the emails older versions saved with the provider's casing,
+// so the unique index and the lookups by email treat them as one address
+func lowercaseEmails(users *mongo.Collection) error {
+	cursor, err := users.Find(context.Background(), bson.M{"email": bson.M{"$regex": "[A-Z]"}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(context.Background()) {
+		var user legacyUser
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+
+		_, err := users.UpdateOne(context.Background(), bson.M{"id": user.Id}, bson.M{
+			"$set": bson.M{"email": strings.ToLower(user.Email)},
+		})
+		// Another account already has the lowercase email, the accounts have to be merged by hand
+		if mongo.IsDuplicateKeyError(err) {
+			fmt.Printf("[Databases] Couldn't lowercase the email of user %s, another account has the same email\n", user.Id)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+func legacyIdentity(provider, subjectId, email string, linkedAt time.Time, profile bson.M) Identity {
+	return Identity{
+		Provider:  provider,
+		SubjectId: subjectId,
+		Email:     email,
+		Profile:   profile,
+		LinkedAt:  linkedAt,
+	}
+}
@@ -2,18 +2,57 @@ package databases
 
 import (
 	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
 )
 
 type UserInfo struct {
-	Id        string      `json:"id" bson:"id"`
-	Username  string      `json:"username" bson:"username"`
-	Email     string      `json:"email" bson:"email"`
-	AvatarURL string      `json:"avatar_url" bson:"avatar_url"`
-	Github    GithubUser  `json:"github,omitempty" bson:"github"`
-	Discord   DiscordUser `json:"discord,omitempty" bson:"discord"`
-	Google    GoogleUser  `json:"google,omitempty" bson:"google"`
-	CreatedAt time.Time   `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at" bson:"updated_at"`
+	Id                  string      `json:"id" bson:"id"`
+	Username            string      `json:"username" bson:"username"`
+	Email               string      `json:"email" bson:"email"`
+	EmailVerified       bool        `json:"email_verified" bson:"email_verified"`
+	AvatarURL           string      `json:"avatar_url" bson:"avatar_url"`
+	PasswordHash        string      `json:"-" bson:"password_hash,omitempty"` //argon2id hash, only set for password accounts
+	Identities          []Identity  `json:"identities" bson:"identities"`
+	Roles               []string    `json:"roles" bson:"roles,omitempty"`
+	MFA                 MFASettings `json:"mfa" bson:"mfa"`
+	DeletionScheduledAt *time.Time  `json:"deletion_scheduled_at,omitempty" bson:"deletion_scheduled_at,omitempty"` //set while the account waits for deletion
+	CreatedAt           time.Time   `json:"created_at" bson:"created_at"`
+	UpdatedAt           time.Time   `json:"updated_at" bson:"updated_at"`
+}
+
+// Identity is a provider account linked to the user, users are looked up by provider and subject id
+type Identity struct {
+	Provider  string                 `json:"provider" bson:"provider"`
+	SubjectId string                 `json:"subject_id" bson:"subject_id"` //the user's id at the provider, it doesn't change with the email
+	Email     string                 `json:"email" bson:"email"`
+	Profile   map[string]interface{} `json:"profile" bson:"profile"`
+	LinkedAt  time.Time              `json:"linked_at" bson:"linked_at"`
+}
+
+type MFASettings struct {
+	TOTPEnabled   bool     `json:"totp_enabled" bson:"totp_enabled"`
+	TOTPSecret    string   `json:"-" bson:"totp_secret,omitempty"`
+	RecoveryCodes []string `json:"-" bson:"recovery_codes,omitempty"` //sha256 hashes of the unused recovery codes
+}
+
+// Passkey is a WebAuthn credential saved in the passkeys collection
+type Passkey struct {
+	Id         string              `json:"id" bson:"id"`
+	UserId     string              `json:"user_id" bson:"user_id"`
+	Name       string              `json:"name" bson:"name"`
+	Credential webauthn.Credential `json:"-" bson:"credential"`
+	CreatedAt  time.Time           `json:"created_at" bson:"created_at"`
+	LastUsedAt time.Time           `json:"last_used_at" bson:"last_used_at"`
+}
+
+// PendingMFA is saved in redis after the first login step of a user with a second factor
+type PendingMFA struct {
+	UserId     string    `json:"user_id"`
+	Provider   string    `json:"provider"`
+	ClientId   string    `json:"client_id,omitempty"`
+	RedirectTo string    `json:"redirect_to,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 type UserSession struct {
@@ -35,6 +74,7 @@ type IPAddressInfo struct {
 }
 
 type GithubUser struct {
+	Id        int64     `json:"id,omitempty"`
 	Username  string    `json:"login,omitempty"`
 	AvatarURL string    `json:"avatar_url,omitempty"`
 	CreatedAt time.Time `json:"created_at,omitempty"`
@@ -58,8 +98,66 @@ type DiscordUser struct {
 }
 
 type GoogleUser struct {
-	Id        string `json:"id,omitempty"`
-	Email     string `json:"email,omitempty"`
-	Username  string `json:"name,omitempty"`
-	AvatarURL string `json:"picture,omitempty"`
+	Id            string `json:"id,omitempty"`
+	Email         string `json:"email,omitempty"`
+	Username      string `json:"name,omitempty"`
+	AvatarURL     string `json:"picture,omitempty"`
+	VerifiedEmail bool   `json:"verified_email,omitempty"`
+}
+
+type GitlabUser struct {
+	Id          int64      `json:"id,omitempty"`
+	Username    string     `json:"username,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Email       string     `json:"email,omitempty"`
+	AvatarURL   string     `json:"avatar_url,omitempty"`
+	WebURL      string     `json:"web_url,omitempty"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+}
+
+type GitlabUserEmail struct {
+	Id          int64      `json:"id"`
+	Email       string     `json:"email"`
+	ConfirmedAt *time.Time `json:"confirmed_at"`
+}
+
+// LoginState is saved in redis under the oAuth state for the duration of the login
+type LoginState struct {
+	Provider string `json:"provider"`
+	Nonce    string `json:"nonce,omitempty"`
+	// CodeVerifier is the PKCE verifier, only its S256 challenge is sent to the provider
+	CodeVerifier string `json:"code_verifier,omitempty"`
+	// BrowserBinding is the hash of the pre-auth cookie set on the browser that started the login
+	BrowserBinding string `json:"browser_binding,omitempty"`
+	// RedirectTo is where the user is sent after the login, checked against REDIRECT_ALLOWLIST
+	RedirectTo string `json:"redirect_to,omitempty"`
+	// ClientId is the client app the login was started for with /login?client_id=<id>
+	ClientId string `json:"client_id,omitempty"`
+	// LinkUserId is set when a logged in user links the provider to their account
+	LinkUserId string `json:"link_user_id,omitempty"`
+}
+
+// Client is an app registered in the clients collection, it can use the service as its OpenID
+// Connect provider and start logins with /login?client_id=<id>
+type Client struct {
+	Id              string    `json:"id" bson:"id"`
+	Name            string    `json:"name" bson:"name"`
+	SecretHash      string    `json:"-" bson:"secret_hash,omitempty"` //sha256 hash of the secret, empty for public clients
+	RedirectURIs    []string  `json:"redirect_uris" bson:"redirect_uris"`
+	AllowedOrigins  []string  `json:"allowed_origins" bson:"allowed_origins"`
+	Scopes          []string  `json:"scopes" bson:"scopes"`
+	SessionDuration string    `json:"session_duration,omitempty" bson:"session_duration,omitempty"` //duration of the app's sessions, SESSION_DURATION when empty
+	CreatedAt       time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// AuditEntry is saved in the audit_log collection for security relevant account changes
+type AuditEntry struct {
+	Id        string    `json:"id" bson:"id"`
+	UserId    string    `json:"user_id" bson:"user_id"`
+	Action    string    `json:"action" bson:"action"`
+	Provider  string    `json:"provider,omitempty" bson:"provider,omitempty"`
+	IP        string    `json:"ip" bson:"ip"`
+	UserAgent string    `json:"user_agent" bson:"user_agent"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
 }
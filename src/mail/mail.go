@@ -0,0 +1,73 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sender sends emails to users
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+var sender Sender
+
+// GetSender returns the configured sender, an SMTPSender by default
+func GetSender() Sender {
+	if sender == nil {
+		sender = &SMTPSender{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}
+	}
+	return sender
+}
+
+// SetSender replaces the sender returned by GetSender
+func SetSender(s Sender) {
+	sender = s
+}
+
+// SMTPSender sends emails through an SMTP server, authentication is skipped
+// when no username is set (e.g. a local SMTP catcher like MailHog)
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(to, subject, body string) error {
+	port := s.Port
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	// Header values must not contain line breaks, they would inject headers
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid recipient or subject")
+	}
+
+	message := "From: " + s.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		body
+
+	return smtp.SendMail(s.Host+":"+port, auth, s.From, []string{to}, []byte(message))
+}
@@ -0,0 +1,160 @@
+package providers
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/x1xo/Auth/src/databases"
+)
+
+// Apple is the Sign in with Apple provider
+type Apple struct {
+	*OIDC
+	TeamId     string
+	KeyId      string
+	PrivateKey *ecdsa.PrivateKey
+}
+
+// AppleClaims are the id_token claims of Sign in with Apple,
+// email_verified and is_private_email are sent either as a bool or a string
+type AppleClaims struct {
+	jwt.RegisteredClaims
+	Nonce          string      `json:"nonce"`
+	Email          string      `json:"email"`
+	EmailVerified  interface{} `json:"email_verified"`
+	IsPrivateEmail interface{} `json:"is_private_email"`
+}
+
+// AppleUser is the user field apple posts on callback, only on the first sign in
+type AppleUser struct {
+	Name struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"name"`
+	Email string `json:"email"`
+}
+
+// NewApple loads the .p8 private key and apple's signing keys
+//
+// clientId - the services id
+// teamId - the apple developer team id
+// keyId - the id of the .p8 key
+// privateKeyPath - the path of the .p8 key
+//
+// returns *Apple or an error
+func NewApple(clientId, teamId, keyId, privateKeyPath string) (*Apple, error) {
+	pem, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := jwt.ParseECPrivateKeyFromPEM(pem)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &Apple{
+		OIDC: &OIDC{
+			name:     "apple",
+			Issuer:   "https://appleid.apple.com",
+			ClientId: clientId,
+			Scopes:   "name email",
+		},
+		TeamId:     teamId,
+		KeyId:      keyId,
+		PrivateKey: privateKey,
+	}
+
+	if err := provider.discover(); err != nil {
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+func (a *Apple) AuthURL(state string, login *databases.LoginState) string {
+	// Apple requires form_post when the name or email scope is requested
+	return a.Config.AuthorizationEndpoint + "?" + url.Values{
+		"response_type":         {"code"},
+		"response_mode":         {"form_post"},
+		"scope":                 {a.Scopes},
+		"redirect_uri":          {CallbackURL(a.Name())},
+		"client_id":             {a.ClientId},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge(login.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+		"nonce":                 {login.Nonce},
+	}.Encode()
+}
+
+func (a *Apple) Exchange(code string, login *databases.LoginState) (*Token, error) {
+	clientSecret, err := a.clientSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	return exchangeCode(a.Config.TokenEndpoint, url.Values{
+		"client_id":     {a.ClientId},
+		"client_secret": {clientSecret},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {CallbackURL(a.Name())},
+		"code_verifier": {login.CodeVerifier},
+	})
+}
+
+func (a *Apple) Profile(token *Token, login *databases.LoginState) (*Profile, error) {
+	var claims AppleClaims
+	if err := a.parseIdToken(token.IdToken, &claims, jwt.WithIssuer(a.Issuer)); err != nil {
+		return nil, err
+	}
+
+	if claims.Nonce == "" || claims.Nonce != login.Nonce {
+		return nil, errors.New("id_token nonce doesn't match")
+	}
+
+	return &Profile{
+		Id:            claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified == true || claims.EmailVerified == "true",
+		Username:      strings.Split(claims.Email, "@")[0],
+		Raw:           &claims,
+	}, nil
+}
+
+// CompleteProfile reads the name apple posts with the first sign in
+func (a *Apple) CompleteProfile(profile *Profile, form url.Values) {
+	if form.Get("user") == "" {
+		return
+	}
+
+	var user AppleUser
+	if err := json.Unmarshal([]byte(form.Get("user")), &user); err != nil {
+		return
+	}
+
+	name := strings.TrimSpace(user.Name.FirstName + " " + user.Name.LastName)
+	if name != "" {
+		profile.Username = name
+	}
+}
+
+// clientSecret generates the short-lived ES256 client secret signed with the .p8 key
+func (a *Apple) clientSecret() (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+		Issuer:    a.TeamId,
+		Subject:   a.ClientId,
+		Audience:  jwt.ClaimStrings{a.Issuer},
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 5)),
+	})
+	token.Header["kid"] = a.KeyId
+
+	return token.SignedString(a.PrivateKey)
+}
@@ -0,0 +1,67 @@
+package providers
+
+import (
+	"net/url"
+
+	"github.com/x1xo/Auth/src/databases"
+)
+
+type Discord struct {
+	ClientId     string
+	ClientSecret string
+	Scopes       string
+}
+
+func NewDiscord(clientId, clientSecret string) *Discord {
+	return &Discord{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Scopes:       "identify guilds.join email",
+	}
+}
+
+func (d *Discord) Name() string {
+	return "discord"
+}
+
+func (d *Discord) AuthURL(state string, login *databases.LoginState) string {
+	return "https://discord.com/oauth2/authorize?" + url.Values{
+		"response_type":         {"code"},
+		"prompt":                {"consent"},
+		"scope":                 {d.Scopes},
+		"redirect_uri":          {CallbackURL(d.Name())},
+		"client_id":             {d.ClientId},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge(login.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+}
+
+func (d *Discord) Exchange(code string, login *databases.LoginState) (*Token, error) {
+	return exchangeCode("https://discord.com/api/oauth2/token", url.Values{
+		"client_id":     {d.ClientId},
+		"client_secret": {d.ClientSecret},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {CallbackURL(d.Name())},
+		"code_verifier": {login.CodeVerifier},
+	})
+}
+
+func (d *Discord) Profile(token *Token, login *databases.LoginState) (*Profile, error) {
+	var userInfo databases.DiscordUser
+	if err := getJSON("https://discord.com/api/users/@me", token, &userInfo); err != nil {
+		return nil, err
+	}
+	userInfo.AvatarURL = "https://cdn.discordapp.com/avatars/" + userInfo.Id + "/" + userInfo.Avatar + ".png"
+	userInfo.Avatar = ""
+
+	return &Profile{
+		Id:            userInfo.Id,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.Verified,
+		Username:      userInfo.Username,
+		AvatarURL:     userInfo.AvatarURL,
+		Raw:           &userInfo,
+	}, nil
+}
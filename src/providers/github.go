@@ -0,0 +1,106 @@
+package providers
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/x1xo/Auth/src/databases"
+)
+
+type Github struct {
+	ClientId     string
+	ClientSecret string
+	Scopes       string
+}
+
+func NewGithub(clientId, clientSecret string) *Github {
+	return &Github{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Scopes:       "user user:email repo repo_deployment",
+	}
+}
+
+func (g *Github) Name() string {
+	return "github"
+}
+
+func (g *Github) AuthURL(state string, login *databases.LoginState) string {
+	return "https://github.com/login/oauth/authorize?" + url.Values{
+		"scope":                 {g.Scopes},
+		"redirect_uri":          {CallbackURL(g.Name())},
+		"client_id":             {g.ClientId},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge(login.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+}
+
+func (g *Github) Exchange(code string, login *databases.LoginState) (*Token, error) {
+	return exchangeCode("https://github.com/login/oauth/access_token", url.Values{
+		"client_id":     {g.ClientId},
+		"client_secret": {g.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {CallbackURL(g.Name())},
+		"code_verifier": {login.CodeVerifier},
+	})
+}
+
+func (g *Github) Profile(token *Token, login *databases.LoginState) (*Profile, error) {
+	var userInfo databases.GithubUser
+	var userEmails []*databases.GithubUserEmail
+	var userErr, emailErr error
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+	//Fetch the user info from github
+	go func() {
+		defer wg.Done()
+		userErr = getJSON("https://api.github.com/user", token, &userInfo)
+	}()
+
+	//Fetch the email list from github
+	go func() {
+		defer wg.Done()
+		emailErr = getJSON("https://api.github.com/user/emails", token, &userEmails)
+	}()
+	wg.Wait()
+
+	if userErr != nil {
+		return nil, userErr
+	}
+	if emailErr != nil {
+		return nil, emailErr
+	}
+
+	userEmail := findPrimaryEmail(userEmails)
+	if userEmail == nil {
+		return nil, errors.New("github account has no primary email")
+	}
+
+	return &Profile{
+		Id:            strconv.FormatInt(userInfo.Id, 10),
+		Email:         userEmail.Email,
+		EmailVerified: userEmail.Verified,
+		Username:      userInfo.Username,
+		AvatarURL:     userInfo.AvatarURL,
+		Raw:           &userInfo,
+	}, nil
+}
+
+// findPrimaryEmail returns the primary email of github account
+//
+// userEmails: []*databases.GithubUserEmail - slice of all emails
+//
+// returns *databases.GithubUserEmail or nil
+func findPrimaryEmail(userEmails []*databases.GithubUserEmail) *databases.GithubUserEmail {
+	for _, email := range userEmails {
+		if email.Primary {
+			return email
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package providers
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/x1xo/Auth/src/databases"
+)
+
+type Gitlab struct {
+	// BaseURL is the url of the gitlab instance, https://gitlab.com by default
+	BaseURL      string
+	ClientId     string
+	ClientSecret string
+	Scopes       string
+}
+
+func NewGitlab(baseURL, clientId, clientSecret string) *Gitlab {
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+
+	return &Gitlab{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Scopes:       "read_user",
+	}
+}
+
+func (g *Gitlab) Name() string {
+	return "gitlab"
+}
+
+func (g *Gitlab) AuthURL(state string, login *databases.LoginState) string {
+	return g.BaseURL + "/oauth/authorize?" + url.Values{
+		"response_type":         {"code"},
+		"scope":                 {g.Scopes},
+		"redirect_uri":          {CallbackURL(g.Name())},
+		"client_id":             {g.ClientId},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge(login.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+}
+
+func (g *Gitlab) Exchange(code string, login *databases.LoginState) (*Token, error) {
+	return exchangeCode(g.BaseURL+"/oauth/token", url.Values{
+		"client_id":     {g.ClientId},
+		"client_secret": {g.ClientSecret},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {CallbackURL(g.Name())},
+		"code_verifier": {login.CodeVerifier},
+	})
+}
+
+func (g *Gitlab) Profile(token *Token, login *databases.LoginState) (*Profile, error) {
+	var userInfo databases.GitlabUser
+	var userEmails []*databases.GitlabUserEmail
+	var userErr, emailErr error
+
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+	//Fetch the user info from gitlab
+	go func() {
+		defer wg.Done()
+		userErr = getJSON(g.BaseURL+"/api/v4/user", token, &userInfo)
+	}()
+
+	//Fetch the secondary emails from gitlab
+	go func() {
+		defer wg.Done()
+		emailErr = getJSON(g.BaseURL+"/api/v4/user/emails", token, &userEmails)
+	}()
+	wg.Wait()
+
+	if userErr != nil {
+		return nil, userErr
+	}
+	if emailErr != nil {
+		return nil, emailErr
+	}
+
+	email := findVerifiedGitlabEmail(&userInfo, userEmails)
+	if email == "" {
+		return nil, errors.New("gitlab account has no verified email")
+	}
+
+	return &Profile{
+		Id:            strconv.FormatInt(userInfo.Id, 10),
+		Email:         email,
+		EmailVerified: true,
+		Username:      userInfo.Username,
+		AvatarURL:     userInfo.AvatarURL,
+		Raw:           &userInfo,
+	}, nil
+}
+
+// findVerifiedGitlabEmail returns the primary email of the gitlab account if it's confirmed,
+// otherwise the first confirmed secondary email
+//
+// userInfo: *databases.GitlabUser - the gitlab user
+// userEmails: []*databases.GitlabUserEmail - slice of the secondary emails
+//
+// returns the email or an empty string
+func findVerifiedGitlabEmail(userInfo *databases.GitlabUser, userEmails []*databases.GitlabUserEmail) string {
+	if userInfo.Email != "" && userInfo.ConfirmedAt != nil {
+		return userInfo.Email
+	}
+	for _, email := range userEmails {
+		if email.ConfirmedAt != nil {
+			return email.Email
+		}
+	}
+	return ""
+}
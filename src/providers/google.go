@@ -0,0 +1,66 @@
+package providers
+
+import (
+	"net/url"
+
+	"github.com/x1xo/Auth/src/databases"
+)
+
+type Google struct {
+	ClientId     string
+	ClientSecret string
+	Scopes       string
+}
+
+func NewGoogle(clientId, clientSecret string) *Google {
+	return &Google{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Scopes:       "profile email",
+	}
+}
+
+func (g *Google) Name() string {
+	return "google"
+}
+
+func (g *Google) AuthURL(state string, login *databases.LoginState) string {
+	return "https://accounts.google.com/o/oauth2/v2/auth?" + url.Values{
+		"prompt":                {"consent"},
+		"response_type":         {"code"},
+		"access_type":           {"offline"},
+		"scope":                 {g.Scopes},
+		"redirect_uri":          {CallbackURL(g.Name())},
+		"client_id":             {g.ClientId},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge(login.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+}
+
+func (g *Google) Exchange(code string, login *databases.LoginState) (*Token, error) {
+	return exchangeCode("https://oauth2.googleapis.com/token", url.Values{
+		"client_id":     {g.ClientId},
+		"client_secret": {g.ClientSecret},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {CallbackURL(g.Name())},
+		"code_verifier": {login.CodeVerifier},
+	})
+}
+
+func (g *Google) Profile(token *Token, login *databases.LoginState) (*Profile, error) {
+	var userInfo databases.GoogleUser
+	if err := getJSON("https://www.googleapis.com/oauth2/v2/userinfo", token, &userInfo); err != nil {
+		return nil, err
+	}
+
+	return &Profile{
+		Id:            userInfo.Id,
+		Email:         userInfo.Email,
+		EmailVerified: userInfo.VerifiedEmail,
+		Username:      userInfo.Username,
+		AvatarURL:     userInfo.AvatarURL,
+		Raw:           &userInfo,
+	}, nil
+}
@@ -0,0 +1,111 @@
+package providers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/x1xo/Auth/src/databases"
+)
+
+// consumerTenantId is the tenant of personal Microsoft accounts
+const consumerTenantId = "9188040d-6c67-4c5b-b112-36a304b66dad"
+
+// Microsoft is the Microsoft identity platform (Entra ID / Azure AD) provider
+type Microsoft struct {
+	*OIDC
+	// Tenant is "common", "organizations", "consumers" or a tenant id
+	Tenant string
+	// AllowedTenants restricts the tid claim, any tenant is allowed when it's empty
+	AllowedTenants []string
+}
+
+// MicrosoftClaims are the id_token claims of the Microsoft identity platform
+type MicrosoftClaims struct {
+	OIDCClaims
+	TenantId string `json:"tid"`
+}
+
+func NewMicrosoft(tenant, clientId, clientSecret string, allowedTenants []string) (*Microsoft, error) {
+	if tenant == "" {
+		tenant = "common"
+	}
+
+	provider := &Microsoft{
+		OIDC: &OIDC{
+			name:         "microsoft",
+			Issuer:       "https://login.microsoftonline.com/" + tenant + "/v2.0",
+			ClientId:     clientId,
+			ClientSecret: clientSecret,
+			Scopes:       "openid email profile",
+		},
+		Tenant:         tenant,
+		AllowedTenants: allowedTenants,
+	}
+
+	// The multi-tenant endpoints return "{tenantid}" in the issuer, so it's checked per token
+	if err := provider.discover(); err != nil {
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+func (m *Microsoft) Profile(token *Token, login *databases.LoginState) (*Profile, error) {
+	var claims MicrosoftClaims
+	if err := m.parseIdToken(token.IdToken, &claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Nonce == "" || claims.Nonce != login.Nonce {
+		return nil, errors.New("id_token nonce doesn't match")
+	}
+
+	if err := m.checkTenant(&claims); err != nil {
+		return nil, err
+	}
+
+	// preferred_username is the UPN, it's set by the tenant admin and isn't a verified
+	// email, so it's only used as the username
+	username := claims.Name
+	if username == "" {
+		username = claims.PreferredUsername
+	}
+
+	return &Profile{
+		Id:        claims.Subject,
+		Email:     claims.Email,
+		Username:  username,
+		AvatarURL: claims.Picture,
+		Raw:       &claims,
+	}, nil
+}
+
+// checkTenant verifies the issuer and tid claims against the configured tenant and allowlist
+func (m *Microsoft) checkTenant(claims *MicrosoftClaims) error {
+	if claims.TenantId == "" {
+		return errors.New("id_token has no tid claim")
+	}
+
+	issuer := strings.Replace(m.Config.Issuer, "{tenantid}", claims.TenantId, 1)
+	if claims.Issuer != issuer {
+		return errors.New("id_token issuer " + claims.Issuer + " doesn't match " + issuer)
+	}
+
+	if m.Tenant == "organizations" && claims.TenantId == consumerTenantId {
+		return errors.New("personal microsoft accounts are not allowed")
+	}
+	if m.Tenant == "consumers" && claims.TenantId != consumerTenantId {
+		return errors.New("work and school accounts are not allowed")
+	}
+
+	if len(m.AllowedTenants) == 0 {
+		return nil
+	}
+	for _, tenant := range m.AllowedTenants {
+		if strings.EqualFold(tenant, claims.TenantId) {
+			return nil
+		}
+	}
+
+	return errors.New("tenant " + claims.TenantId + " is not allowed")
+}
@@ -0,0 +1,144 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/x1xo/Auth/src/databases"
+)
+
+// OAuth2 is a generic oAuth2 provider with a json profile endpoint
+type OAuth2 struct {
+	name         string
+	ClientId     string
+	ClientSecret string
+	Scopes       string
+	AuthorizeURL string
+	TokenURL     string
+	ProfileURL   string
+	Fields       OAuth2Fields
+}
+
+// OAuth2Fields are the json paths (e.g. "data.0.login") of the profile fields
+type OAuth2Fields struct {
+	Id    string
+	Email string
+	// EmailVerified is empty when the provider doesn't tell if the email is verified
+	EmailVerified string
+	Username      string
+	AvatarURL     string
+}
+
+func NewOAuth2(name string) *OAuth2 {
+	return &OAuth2{
+		name: name,
+		Fields: OAuth2Fields{
+			Id:        "id",
+			Email:     "email",
+			Username:  "username",
+			AvatarURL: "avatar_url",
+		},
+	}
+}
+
+func (o *OAuth2) Name() string {
+	return o.name
+}
+
+func (o *OAuth2) AuthURL(state string, login *databases.LoginState) string {
+	separator := "?"
+	if strings.Contains(o.AuthorizeURL, "?") {
+		separator = "&"
+	}
+
+	return o.AuthorizeURL + separator + url.Values{
+		"response_type":         {"code"},
+		"scope":                 {o.Scopes},
+		"redirect_uri":          {CallbackURL(o.Name())},
+		"client_id":             {o.ClientId},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge(login.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+}
+
+func (o *OAuth2) Exchange(code string, login *databases.LoginState) (*Token, error) {
+	return exchangeCode(o.TokenURL, url.Values{
+		"client_id":     {o.ClientId},
+		"client_secret": {o.ClientSecret},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {CallbackURL(o.Name())},
+		"code_verifier": {login.CodeVerifier},
+	})
+}
+
+func (o *OAuth2) Profile(token *Token, login *databases.LoginState) (*Profile, error) {
+	var body json.RawMessage
+	if err := getJSON(o.ProfileURL, token, &body); err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var data interface{}
+	if err := decoder.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	profile := &Profile{
+		Id:            lookupPath(data, o.Fields.Id),
+		Email:         lookupPath(data, o.Fields.Email),
+		EmailVerified: lookupPath(data, o.Fields.EmailVerified) == "true",
+		Username:      lookupPath(data, o.Fields.Username),
+		AvatarURL:     lookupPath(data, o.Fields.AvatarURL),
+		Raw:           data,
+	}
+	if profile.Id == "" {
+		return nil, fmt.Errorf("profile of %s has no %s field", o.Name(), o.Fields.Id)
+	}
+
+	return profile, nil
+}
+
+// lookupPath returns the value at the dot separated path as a string
+//
+// data - the decoded json document
+// path - the path, array items are addressed by their index ("data.0.id")
+//
+// returns the value or an empty string if the path doesn't exist
+func lookupPath(data interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch value := data.(type) {
+		case map[string]interface{}:
+			data = value[key]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(value) {
+				return ""
+			}
+			data = value[index]
+		default:
+			return ""
+		}
+	}
+
+	switch value := data.(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	return ""
+}
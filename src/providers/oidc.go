@@ -0,0 +1,332 @@
+package providers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/x1xo/Auth/src/databases"
+)
+
+// OIDC is a generic OpenID Connect provider configured through discovery
+type OIDC struct {
+	name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	Scopes       string
+	Config       *OIDCConfiguration
+
+	keysMutex sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+}
+
+// OIDCConfiguration is the subset of /.well-known/openid-configuration that we use
+type OIDCConfiguration struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// OIDCClaims are the id_token claims mapped to the user profile
+type OIDCClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Picture           string `json:"picture"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewOIDC loads the issuer's discovery document and signing keys
+//
+// name - the provider name used in /login?provider=<name>
+// issuer - the issuer url, without /.well-known/openid-configuration
+//
+// returns *OIDC or an error if the issuer couldn't be discovered
+func NewOIDC(name, issuer, clientId, clientSecret, scopes string) (*OIDC, error) {
+	if scopes == "" {
+		scopes = "openid email profile"
+	}
+
+	provider := &OIDC{
+		name:         name,
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+	}
+
+	if err := provider.discover(); err != nil {
+		return nil, err
+	}
+	if provider.Config.Issuer != provider.Issuer {
+		return nil, errors.New("discovered issuer " + provider.Config.Issuer + " doesn't match " + provider.Issuer)
+	}
+
+	return provider, nil
+}
+
+// discover loads the discovery document and the signing keys of the issuer
+func (o *OIDC) discover() error {
+	response, err := http.Get(o.Issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return errors.New("discovery returned status " + response.Status)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	var config OIDCConfiguration
+	if err := json.Unmarshal(body, &config); err != nil {
+		return err
+	}
+	o.Config = &config
+
+	return o.loadKeys()
+}
+
+func (o *OIDC) Name() string {
+	return o.name
+}
+
+func (o *OIDC) AuthURL(state string, login *databases.LoginState) string {
+	return o.Config.AuthorizationEndpoint + "?" + url.Values{
+		"response_type":         {"code"},
+		"scope":                 {o.Scopes},
+		"redirect_uri":          {CallbackURL(o.Name())},
+		"client_id":             {o.ClientId},
+		"state":                 {state},
+		"code_challenge":        {codeChallenge(login.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+		"nonce":                 {login.Nonce},
+	}.Encode()
+}
+
+func (o *OIDC) Exchange(code string, login *databases.LoginState) (*Token, error) {
+	return exchangeCode(o.Config.TokenEndpoint, url.Values{
+		"client_id":     {o.ClientId},
+		"client_secret": {o.ClientSecret},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {CallbackURL(o.Name())},
+		"code_verifier": {login.CodeVerifier},
+	})
+}
+
+func (o *OIDC) Profile(token *Token, login *databases.LoginState) (*Profile, error) {
+	claims, err := o.VerifyIdToken(token.IdToken, login.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Name
+	}
+
+	return &Profile{
+		Id:            claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Username:      username,
+		AvatarURL:     claims.Picture,
+		Raw:           claims,
+	}, nil
+}
+
+// VerifyIdToken checks the signature, issuer, audience, expiry and nonce of the id_token
+//
+// idToken - the id_token returned from the token endpoint
+// nonce - the nonce sent with the authorization request
+//
+// returns *OIDCClaims or an error
+func (o *OIDC) VerifyIdToken(idToken, nonce string) (*OIDCClaims, error) {
+	var claims OIDCClaims
+	if err := o.parseIdToken(idToken, &claims, jwt.WithIssuer(o.Config.Issuer)); err != nil {
+		return nil, err
+	}
+
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("id_token nonce doesn't match")
+	}
+
+	return &claims, nil
+}
+
+// parseIdToken verifies the signature, audience and expiry of the id_token and decodes it into claims
+func (o *OIDC) parseIdToken(idToken string, claims jwt.Claims, options ...jwt.ParserOption) error {
+	if idToken == "" {
+		return errors.New("token endpoint didn't return an id_token")
+	}
+
+	options = append(options,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithAudience(o.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+
+	_, err := jwt.ParseWithClaims(idToken, claims, o.keyFunc, options...)
+	return err
+}
+
+// keyFunc returns the signing key for the token's kid, refreshing the key set
+// once when the kid is unknown because the issuer may have rotated its keys
+func (o *OIDC) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	if key := o.findKey(kid); key != nil {
+		return key, nil
+	}
+
+	o.keysMutex.RLock()
+	recentlyLoaded := time.Since(o.keysAt) < time.Minute
+	o.keysMutex.RUnlock()
+
+	if !recentlyLoaded {
+		if err := o.loadKeys(); err != nil {
+			return nil, err
+		}
+		if key := o.findKey(kid); key != nil {
+			return key, nil
+		}
+	}
+
+	return nil, errors.New("signing key " + kid + " was not found")
+}
+
+func (o *OIDC) findKey(kid string) crypto.PublicKey {
+	o.keysMutex.RLock()
+	defer o.keysMutex.RUnlock()
+
+	if kid == "" && len(o.keys) == 1 {
+		for _, key := range o.keys {
+			return key
+		}
+	}
+	return o.keys[kid]
+}
+
+// loadKeys fetches the issuer's JWKS
+func (o *OIDC) loadKeys() error {
+	response, err := http.Get(o.Config.JwksURI)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return errors.New("jwks returned status " + response.Status)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	o.keysMutex.Lock()
+	o.keys = keys
+	o.keysAt = time.Now()
+	o.keysMutex.Unlock()
+
+	return nil
+}
+
+// publicKey decodes the RSA or EC public key from the JWK
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("unsupported curve " + jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	}
+
+	return nil, errors.New("unsupported key type " + jwk.Kty)
+}
@@ -0,0 +1,313 @@
+package providers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/x1xo/Auth/src/databases"
+)
+
+// Provider is an oAuth provider that users can log in with
+type Provider interface {
+	// Name is the identifier used in /login?provider=<name> and /callback/<name>
+	Name() string
+	// AuthURL returns the url of the provider's consent screen
+	AuthURL(state string, login *databases.LoginState) string
+	// Exchange exchanges the code returned on callback for an access token
+	Exchange(code string, login *databases.LoginState) (*Token, error)
+	// Profile fetches the user's profile with the access token
+	Profile(token *Token, login *databases.LoginState) (*Profile, error)
+}
+
+// FormPostProvider is implemented by providers that POST the callback (response_mode=form_post)
+// with extra fields next to the code and state
+type FormPostProvider interface {
+	Provider
+	// CompleteProfile fills the profile with the fields posted on callback
+	CompleteProfile(profile *Profile, form url.Values)
+}
+
+// Token is the response of a provider's token endpoint
+type Token struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IdToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Profile is the normalized user profile returned by a provider
+type Profile struct {
+	Id    string
+	Email string
+	// EmailVerified is true when the provider verified that the user owns the email
+	EmailVerified bool
+	Username      string
+	AvatarURL     string
+	// Raw is the provider specific document (databases.GithubUser, ...)
+	Raw interface{}
+}
+
+// Identity returns the identity to save on the user for this profile
+//
+// provider - the name of the provider the profile is from
+func (p *Profile) Identity(provider string) databases.Identity {
+	// The raw profile is saved with the provider's own field names
+	var raw map[string]interface{}
+	if data, err := json.Marshal(p.Raw); err == nil {
+		json.Unmarshal(data, &raw)
+	}
+
+	return databases.Identity{
+		Provider:  provider,
+		SubjectId: p.Id,
+		Email:     p.Email,
+		Profile:   raw,
+		LinkedAt:  time.Now(),
+	}
+}
+
+// Attach adds the provider identity to the user, or updates it when it's already linked
+//
+// provider - the name of the provider the profile is from
+func (p *Profile) Attach(user *databases.UserInfo, provider string) {
+	identity := p.Identity(provider)
+	for i, linked := range user.Identities {
+		// Identities migrated without a subject id get it on the next login
+		if linked.Provider == provider && (linked.SubjectId == p.Id || linked.SubjectId == "") {
+			identity.LinkedAt = linked.LinkedAt
+			user.Identities[i] = identity
+			return
+		}
+	}
+	user.Identities = append(user.Identities, identity)
+}
+
+var registry = map[string]Provider{}
+
+// Register adds the provider to the registry, replacing any provider with the same name
+func Register(provider Provider) {
+	registry[provider.Name()] = provider
+}
+
+// Get returns the registered provider with the given name
+func Get(name string) (Provider, bool) {
+	provider, ok := registry[name]
+	return provider, ok
+}
+
+// Names returns the names of all registered providers
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load registers every provider that is configured in the environment
+func Load() {
+	if clientId := os.Getenv("GITHUB_CLIENT_ID"); clientId != "" {
+		Register(NewGithub(clientId, os.Getenv("GITHUB_CLIENT_SECRET")))
+	}
+	if clientId := os.Getenv("GOOGLE_CLIENT_ID"); clientId != "" {
+		Register(NewGoogle(clientId, os.Getenv("GOOGLE_CLIENT_SECRET")))
+	}
+	if clientId := os.Getenv("DISCORD_CLIENT_ID"); clientId != "" {
+		Register(NewDiscord(clientId, os.Getenv("DISCORD_CLIENT_SECRET")))
+	}
+	if clientId := os.Getenv("GITLAB_CLIENT_ID"); clientId != "" {
+		Register(NewGitlab(os.Getenv("GITLAB_URL"), clientId, os.Getenv("GITLAB_CLIENT_SECRET")))
+	}
+	if clientId := os.Getenv("MICROSOFT_CLIENT_ID"); clientId != "" {
+		provider, err := NewMicrosoft(
+			os.Getenv("MICROSOFT_TENANT"),
+			clientId,
+			os.Getenv("MICROSOFT_CLIENT_SECRET"),
+			splitList(os.Getenv("MICROSOFT_ALLOWED_TENANTS")),
+		)
+		if err != nil {
+			log.Println("[Providers] Couldn't load microsoft provider:", err)
+		} else {
+			Register(provider)
+		}
+	}
+	if clientId := os.Getenv("APPLE_CLIENT_ID"); clientId != "" {
+		provider, err := NewApple(
+			clientId,
+			os.Getenv("APPLE_TEAM_ID"),
+			os.Getenv("APPLE_KEY_ID"),
+			os.Getenv("APPLE_PRIVATE_KEY_PATH"),
+		)
+		if err != nil {
+			log.Println("[Providers] Couldn't load apple provider:", err)
+		} else {
+			Register(provider)
+		}
+	}
+
+	// OIDC_PROVIDERS=keycloak,okta reads OIDC_KEYCLOAK_ISSUER, OIDC_KEYCLOAK_CLIENT_ID, ...
+	for _, name := range splitList(os.Getenv("OIDC_PROVIDERS")) {
+		provider, err := NewOIDC(
+			name,
+			envFor("OIDC", name, "ISSUER"),
+			envFor("OIDC", name, "CLIENT_ID"),
+			envFor("OIDC", name, "CLIENT_SECRET"),
+			envFor("OIDC", name, "SCOPES"),
+		)
+		if err != nil {
+			log.Printf("[Providers] Couldn't load OIDC provider %s: %v", name, err)
+			continue
+		}
+		Register(provider)
+	}
+
+	// OAUTH2_PROVIDERS=gitea,twitch reads OAUTH2_GITEA_AUTHORIZE_URL, OAUTH2_GITEA_ID_FIELD, ...
+	for _, name := range splitList(os.Getenv("OAUTH2_PROVIDERS")) {
+		provider := NewOAuth2(name)
+		provider.ClientId = envFor("OAUTH2", name, "CLIENT_ID")
+		provider.ClientSecret = envFor("OAUTH2", name, "CLIENT_SECRET")
+		provider.Scopes = envFor("OAUTH2", name, "SCOPES")
+		provider.AuthorizeURL = envFor("OAUTH2", name, "AUTHORIZE_URL")
+		provider.TokenURL = envFor("OAUTH2", name, "TOKEN_URL")
+		provider.ProfileURL = envFor("OAUTH2", name, "PROFILE_URL")
+
+		if provider.AuthorizeURL == "" || provider.TokenURL == "" || provider.ProfileURL == "" {
+			log.Printf("[Providers] Couldn't load oAuth2 provider %s: authorize, token and profile urls are required", name)
+			continue
+		}
+
+		if field := envFor("OAUTH2", name, "ID_FIELD"); field != "" {
+			provider.Fields.Id = field
+		}
+		if field := envFor("OAUTH2", name, "EMAIL_FIELD"); field != "" {
+			provider.Fields.Email = field
+		}
+		if field := envFor("OAUTH2", name, "EMAIL_VERIFIED_FIELD"); field != "" {
+			provider.Fields.EmailVerified = field
+		}
+		if field := envFor("OAUTH2", name, "USERNAME_FIELD"); field != "" {
+			provider.Fields.Username = field
+		}
+		if field := envFor("OAUTH2", name, "AVATAR_FIELD"); field != "" {
+			provider.Fields.AvatarURL = field
+		}
+
+		Register(provider)
+	}
+
+	log.Println("[Providers] Loaded providers:", strings.Join(Names(), ", "))
+}
+
+// envFor returns the provider specific environment variable <PREFIX>_<NAME>_<KEY>
+func envFor(prefix, name, key string) string {
+	name = strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	return os.Getenv(prefix + "_" + name + "_" + key)
+}
+
+// splitList splits a comma separated environment variable
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// CallbackURL returns the url the provider redirects to after the consent screen
+func CallbackURL(name string) string {
+	return os.Getenv("CALLBACK_URL") + "/callback/" + name
+}
+
+// codeChallenge returns the S256 PKCE code challenge of the code verifier
+func codeChallenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// exchangeCode posts the form to the provider's token endpoint
+//
+// tokenURL - the provider's token endpoint
+// form - the form values (client_id, code, ...)
+//
+// returns *Token or an error
+func exchangeCode(tokenURL string, form url.Values) (*Token, error) {
+	request, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, err
+	}
+
+	if token.Error != "" {
+		return nil, errors.New("token endpoint returned error: " + token.Error)
+	}
+	if response.StatusCode != 200 {
+		return nil, errors.New("token endpoint returned status " + response.Status)
+	}
+
+	return &token, nil
+}
+
+// getJSON fetches the url with the access token and decodes the json body into v
+func getJSON(url string, token *Token, v interface{}) error {
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	tokenType := token.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Authorization", tokenType+" "+token.AccessToken)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return errors.New(url + " returned status " + response.Status)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
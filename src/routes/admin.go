@@ -0,0 +1,233 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/x1xo/Auth/src/databases"
+	"github.com/x1xo/Auth/src/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type clientRequest struct {
+	Name            string   `json:"name"`
+	Public          bool     `json:"public"`
+	RedirectURIs    []string `json:"redirect_uris"`
+	AllowedOrigins  []string `json:"allowed_origins"`
+	Scopes          []string `json:"scopes"`
+	SessionDuration string   `json:"session_duration"`
+}
+
+// validate checks the client settings
+//
+// returns the error message or an empty string if the settings are valid
+func (r *clientRequest) validate() string {
+	if strings.TrimSpace(r.Name) == "" {
+		return "Name is required."
+	}
+
+	for _, redirectURI := range r.RedirectURIs {
+		parsed, err := url.Parse(redirectURI)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Fragment != "" {
+			return "Redirect uri " + redirectURI + " must be an absolute url without a fragment."
+		}
+	}
+
+	for _, origin := range r.AllowedOrigins {
+		parsed, err := url.Parse(origin)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || parsed.Scheme+"://"+parsed.Host != origin {
+			return "Origin " + origin + " must be a scheme and host like https://app.example.com."
+		}
+	}
+
+	for _, scope := range r.Scopes {
+		if !hasScope(strings.Join(supportedScopes, " "), scope) {
+			return "Scope " + scope + " is not supported."
+		}
+	}
+
+	if r.SessionDuration != "" {
+		if duration, err := time.ParseDuration(r.SessionDuration); err != nil || duration <= 0 {
+			return "Session duration must be a positive duration like 24h."
+		}
+	}
+
+	return ""
+}
+
+// GET "/api/admin/clients"
+func GetClients(c *fiber.Ctx) error {
+	cursor, err := databases.GetMongoDatabase().Collection("clients").Find(context.Background(), bson.M{})
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	clients := []databases.Client{}
+	if err := cursor.All(context.Background(), &clients); err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.JSON(clients)
+}
+
+// GET "/api/admin/clients/:clientId"
+func GetClient(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c.Params("clientId", ""))
+	if !ok {
+		return utils.ErrorResponse(c, 404, "NOT_FOUND", "Client was not found.")
+	}
+
+	return c.JSON(client)
+}
+
+// POST "/api/admin/clients"
+func CreateClient(c *fiber.Ctx) error {
+	var body clientRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Body must contain the client settings.")
+	}
+	if message := body.validate(); message != "" {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", message)
+	}
+
+	client := databases.Client{
+		Id:              uuid.New().String(),
+		Name:            strings.TrimSpace(body.Name),
+		RedirectURIs:    body.RedirectURIs,
+		AllowedOrigins:  body.AllowedOrigins,
+		Scopes:          body.Scopes,
+		SessionDuration: body.SessionDuration,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+
+	// Only the hash of the secret is stored, it's shown once in the response
+	var secret string
+	if !body.Public {
+		var err error
+		secret, err = utils.RandomId(32)
+		if err != nil {
+			return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+		}
+		client.SecretHash = utils.HashToken(secret)
+	}
+
+	if _, err := databases.GetMongoDatabase().Collection("clients").InsertOne(context.Background(), &client); err != nil {
+		log.Println("[Error] Couldn't insert client: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+	utils.InvalidateClientOrigins()
+
+	return c.Status(201).JSON(fiber.Map{
+		"client":        client,
+		"client_secret": secret,
+	})
+}
+
+// PUT "/api/admin/clients/:clientId"
+func UpdateClient(c *fiber.Ctx) error {
+	var body clientRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Body must contain the client settings.")
+	}
+	if message := body.validate(); message != "" {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", message)
+	}
+
+	result, err := databases.GetMongoDatabase().Collection("clients").UpdateOne(context.Background(), bson.M{"id": c.Params("clientId", "")}, bson.M{
+		"$set": bson.M{
+			"name":             strings.TrimSpace(body.Name),
+			"redirect_uris":    body.RedirectURIs,
+			"allowed_origins":  body.AllowedOrigins,
+			"scopes":           body.Scopes,
+			"session_duration": body.SessionDuration,
+			"updated_at":       time.Now(),
+		},
+	})
+	if err != nil {
+		log.Println("[Error] Couldn't update client: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrorResponse(c, 404, "NOT_FOUND", "Client was not found.")
+	}
+	utils.InvalidateClientOrigins()
+
+	client, _ := utils.GetClient(c.Params("clientId", ""))
+	return c.JSON(client)
+}
+
+// POST "/api/admin/clients/:clientId/secret"
+func RotateClientSecret(c *fiber.Ctx) error {
+	client, ok := utils.GetClient(c.Params("clientId", ""))
+	if !ok {
+		return utils.ErrorResponse(c, 404, "NOT_FOUND", "Client was not found.")
+	}
+	if client.SecretHash == "" {
+		return utils.ErrorResponse(c, 400, "PUBLIC_CLIENT", "Public clients don't have a secret.")
+	}
+
+	// The old secret stops working right away
+	secret, err := utils.RandomId(32)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	_, err = databases.GetMongoDatabase().Collection("clients").UpdateOne(context.Background(), bson.M{"id": client.Id}, bson.M{
+		"$set": bson.M{"secret_hash": utils.HashToken(secret), "updated_at": time.Now()},
+	})
+	if err != nil {
+		log.Println("[Error] Couldn't rotate client secret: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.JSON(fiber.Map{
+		"client_secret": secret,
+	})
+}
+
+// DELETE "/api/admin/clients/:clientId"
+func DeleteClient(c *fiber.Ctx) error {
+	result, err := databases.GetMongoDatabase().Collection("clients").DeleteOne(context.Background(), bson.M{"id": c.Params("clientId", "")})
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+	if result.DeletedCount == 0 {
+		return utils.ErrorResponse(c, 404, "NOT_FOUND", "Client was not found.")
+	}
+	utils.InvalidateClientOrigins()
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// PUT "/api/admin/users/:userId/roles"
+func SetUserRoles(c *fiber.Ctx) error {
+	var body struct {
+		Roles []string `json:"roles"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Roles == nil {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Body must contain roles.")
+	}
+
+	result, err := databases.GetMongoDatabase().Collection("users").UpdateOne(context.Background(), bson.M{"id": c.Params("userId", "")}, bson.M{
+		"$set": bson.M{"roles": body.Roles, "updated_at": time.Now()},
+	})
+	if err != nil {
+		log.Println("[Error] Couldn't set user roles: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrorResponse(c, 404, "NOT_FOUND", "User was not found.")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+	})
+}
@@ -0,0 +1,231 @@
+package callbackRoutes
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/x1xo/Auth/src/databases"
+	"github.com/x1xo/Auth/src/providers"
+	"github.com/x1xo/Auth/src/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GET, POST "/callback/:provider"
+func Callback(c *fiber.Ctx) error {
+	provider, ok := providers.Get(c.Params("provider"))
+	if !ok {
+		return utils.ErrorRedirect(c, 404, "PROVIDER_NOT_FOUND", "Provider was not found.")
+	}
+
+	// form_post providers send the callback as a POST form instead of query parameters
+	formPostProvider, isFormPost := provider.(providers.FormPostProvider)
+	if c.Method() == fiber.MethodPost && !isFormPost {
+		return utils.ErrorRedirect(c, 405, "METHOD_NOT_ALLOWED", "Provider doesn't support POST callbacks.")
+	}
+
+	state := callbackValue(c, "state")
+	code := callbackValue(c, "code")
+
+	// GetDel makes the state single-use, concurrent callbacks with the same state can't both pass
+	result, err := databases.GetRedis().GetDel(context.Background(), state).Result()
+	if err != nil {
+		log.Println("[Error] Couldn't get state from redis: \n", err)
+		return utils.ErrorRedirect(c, 400, "INVALID_STATE", "Invalid state was recived on callback. XSS?")
+	}
+
+	var loginState databases.LoginState
+	if err := json.Unmarshal([]byte(result), &loginState); err != nil || loginState.Provider != provider.Name() {
+		return utils.ErrorRedirect(c, 400, "INVALID_STATE", "Invalid state was recived on callback. XSS?")
+	}
+
+	browserBinding := c.Cookies(utils.LoginStateCookie, "")
+	c.Cookie(&fiber.Cookie{
+		Name:    utils.LoginStateCookie,
+		Path:    "/callback",
+		Expires: time.Unix(0, 0),
+	})
+	if browserBinding == "" || subtle.ConstantTimeCompare([]byte(utils.HashToken(browserBinding)), []byte(loginState.BrowserBinding)) != 1 {
+		return utils.ErrorRedirect(c, 400, "INVALID_STATE", "Login was started from a different browser.")
+	}
+
+	// The user cancelled the consent screen or the provider couldn't complete the login
+	if providerErrorCode := callbackValue(c, "error"); providerErrorCode != "" {
+		return providerError(c, provider.Name(), providerErrorCode, callbackValue(c, "error_description"))
+	}
+	if code == "" {
+		return utils.ErrorRedirect(c, 400, "INVALID_REQUEST", "Code was not recived on callback.")
+	}
+
+	token, err := provider.Exchange(code, &loginState)
+	if err != nil {
+		log.Printf("[Error] Couldn't exchange code with %s: \n%v", provider.Name(), err)
+		return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	profile, err := provider.Profile(token, &loginState)
+	if err != nil {
+		log.Printf("[Error] Couldn't get user info from %s: \n%v", provider.Name(), err)
+		return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if isFormPost && c.Method() == fiber.MethodPost {
+		form, err := url.ParseQuery(string(c.Body()))
+		if err == nil {
+			formPostProvider.CompleteProfile(profile, form)
+		}
+	}
+
+	// Emails are saved lowercase, the same way the password and email logins save them
+	profile.Email = strings.ToLower(profile.Email)
+
+	db := databases.GetMongoDatabase()
+
+	// The subject id doesn't change with the email, so it's checked before the email
+	user, err := findByIdentity(provider.Name(), profile.Id)
+	if err != nil {
+		log.Println("[Error] Couldn't find user by identity: \n", err)
+		return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if loginState.LinkUserId != "" {
+		return link(c, provider.Name(), profile, user, &loginState)
+	}
+
+	if user == nil {
+		user = &databases.UserInfo{}
+		// Without an email there is no account to match, the provider account gets a new user
+		err = mongo.ErrNoDocuments
+		if profile.Email != "" {
+			err = db.Collection("users").FindOne(context.Background(), bson.M{"email": profile.Email}).Decode(user)
+		}
+		if err == mongo.ErrNoDocuments {
+			user = &databases.UserInfo{
+				Id:            uuid.New().String(),
+				Email:         profile.Email,
+				EmailVerified: profile.EmailVerified,
+				Username:      profile.Username,
+				AvatarURL:     profile.AvatarURL,
+				CreatedAt:     time.Now(),
+				UpdatedAt:     time.Now(),
+			}
+			profile.Attach(user, provider.Name())
+			if _, err := db.Collection("users").InsertOne(context.Background(), user); mongo.IsDuplicateKeyError(err) {
+				return utils.ErrorRedirect(c, 409, "ACCOUNT_EXISTS", "An account with this email already exists. Log in and link the provider from your account.")
+			} else if err != nil {
+				log.Println("[Error] Couldn't insert user: \n", err)
+				return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+			}
+		} else if err != nil {
+			log.Println("[Error] Couldn't find user by email: \n", err)
+			return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+		} else {
+			// Anyone can create an account with someone else's email on a provider that doesn't
+			// verify it, so accounts are only merged when both sides proved the email. Migrated
+			// identities were already linked by this email, they only need the provider to verify it
+			migrated := hasMigratedIdentity(user, provider.Name())
+			if !profile.EmailVerified || !strings.EqualFold(profile.Email, user.Email) || (!migrated && !user.EmailVerified) {
+				return utils.ErrorRedirect(c, 409, "ACCOUNT_EXISTS", "An account with this email already exists. Log in and link the provider from your account.")
+			}
+			if !migrated {
+				utils.Audit(c, user.Id, utils.AuditProviderLinked, provider.Name())
+			}
+		}
+	}
+
+	profile.Attach(user, provider.Name())
+	if profile.EmailVerified && profile.Email != "" && strings.EqualFold(profile.Email, user.Email) {
+		user.EmailVerified = true
+	}
+	user.UpdatedAt = time.Now()
+
+	go func() { db.Collection("users").ReplaceOne(context.Background(), bson.M{"id": user.Id}, user) }()
+
+	if utils.RequiresMFA(user) {
+		if _, err := utils.CreatePendingMFA(c, user.Id, provider.Name(), loginState.ClientId, loginState.RedirectTo); err != nil {
+			return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+		}
+		return utils.MFARedirect(c)
+	}
+
+	if _, err := utils.IssueSession(c, user.Id, provider.Name(), loginState.ClientId); err != nil {
+		return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.Redirect(utils.LoginRedirect(loginState.ClientId, loginState.RedirectTo))
+}
+
+// findByIdentity returns the user the provider account is linked to, or nil if it isn't linked
+func findByIdentity(providerName, subjectId string) (*databases.UserInfo, error) {
+	if subjectId == "" {
+		return nil, nil
+	}
+
+	var user databases.UserInfo
+	err := databases.GetMongoDatabase().Collection("users").FindOne(context.Background(), bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": providerName, "subject_id": subjectId}},
+	}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// hasMigratedIdentity reports whether the user has an identity of the provider saved without a subject id
+func hasMigratedIdentity(user *databases.UserInfo, providerName string) bool {
+	for _, identity := range user.Identities {
+		if identity.Provider == providerName && identity.SubjectId == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// link attaches the provider to the user that started the login with link=true
+//
+// linked - the user the provider account is already linked to, or nil
+func link(c *fiber.Ctx, providerName string, profile *providers.Profile, linked *databases.UserInfo, loginState *databases.LoginState) error {
+	db := databases.GetMongoDatabase()
+
+	// The provider account must not be the login of another account
+	if linked != nil && linked.Id != loginState.LinkUserId {
+		return utils.ErrorRedirect(c, 409, "PROVIDER_ALREADY_LINKED", "This provider account belongs to another account.")
+	}
+
+	var user databases.UserInfo
+	err := db.Collection("users").FindOne(context.Background(), bson.M{"id": loginState.LinkUserId}).Decode(&user)
+	if err != nil {
+		return utils.ErrorRedirect(c, 401, "UNAUTHENTICATED", "Account to link the provider to was not found.")
+	}
+
+	profile.Attach(&user, providerName)
+	user.UpdatedAt = time.Now()
+
+	if _, err := db.Collection("users").ReplaceOne(context.Background(), bson.M{"id": user.Id}, user); err != nil {
+		log.Println("[Error] Couldn't link provider: \n", err)
+		return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	utils.Audit(c, user.Id, utils.AuditProviderLinked, providerName)
+
+	return c.Redirect(utils.LoginRedirect(loginState.ClientId, loginState.RedirectTo))
+}
+
+// callbackValue returns the callback parameter from the query, or from the form on POST callbacks
+func callbackValue(c *fiber.Ctx, key string) string {
+	if c.Method() == fiber.MethodPost {
+		return c.FormValue(key, "")
+	}
+	return c.Query(key, "")
+}
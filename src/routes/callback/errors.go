@@ -0,0 +1,47 @@
+package callbackRoutes
+
+import (
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/x1xo/Auth/src/utils"
+)
+
+// providerErrors maps the oAuth error codes sent by providers to our error codes
+var providerErrors = map[string]string{
+	"access_denied":             "ACCESS_DENIED",
+	"user_cancelled_authorize":  "ACCESS_DENIED", // apple
+	"consent_required":          "CONSENT_REQUIRED",
+	"interaction_required":      "CONSENT_REQUIRED",
+	"login_required":            "CONSENT_REQUIRED",
+	"temporarily_unavailable":   "PROVIDER_UNAVAILABLE",
+	"server_error":              "PROVIDER_UNAVAILABLE",
+	"invalid_request":           "PROVIDER_MISCONFIGURED",
+	"invalid_scope":             "PROVIDER_MISCONFIGURED",
+	"unauthorized_client":       "PROVIDER_MISCONFIGURED",
+	"unsupported_response_type": "PROVIDER_MISCONFIGURED",
+}
+
+var errorMessages = map[string]string{
+	"ACCESS_DENIED":          "The login was cancelled on the provider's consent screen.",
+	"CONSENT_REQUIRED":       "The provider requires the user to log in or consent again.",
+	"PROVIDER_UNAVAILABLE":   "The provider is temporarily unavailable. Try again later.",
+	"PROVIDER_MISCONFIGURED": "The provider rejected the login request.",
+	"PROVIDER_ERROR":         "The provider returned an error.",
+}
+
+// providerError handles the error sent by the provider instead of a code
+//
+// providerName - the name of the provider
+// errorCode - the error parameter of the callback
+// description - the error_description parameter of the callback
+func providerError(c *fiber.Ctx, providerName, errorCode, description string) error {
+	log.Printf("[Error] %s returned error on callback: %s %s", providerName, errorCode, description)
+
+	code, ok := providerErrors[errorCode]
+	if !ok {
+		code = "PROVIDER_ERROR"
+	}
+
+	return utils.ErrorRedirect(c, 400, code, errorMessages[code])
+}
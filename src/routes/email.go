@@ -0,0 +1,214 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"log"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/x1xo/Auth/src/databases"
+	mailer "github.com/x1xo/Auth/src/mail"
+	"github.com/x1xo/Auth/src/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type magicLink struct {
+	Email      string `json:"email"`
+	ClientId   string `json:"client_id,omitempty"`
+	RedirectTo string `json:"redirect_to,omitempty"`
+}
+
+// claimAccount verifies the email of the user and removes the password, passkeys, second
+// factors, linked providers and sessions that were set up before the email was proven
+func claimAccount(user *databases.UserInfo) error {
+	db := databases.GetMongoDatabase()
+
+	_, err := db.Collection("users").UpdateOne(context.Background(), bson.M{"id": user.Id}, bson.M{
+		"$set":   bson.M{"email_verified": true, "identities": []databases.Identity{}, "updated_at": time.Now()},
+		"$unset": bson.M{"password_hash": "", "mfa": ""},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Collection("passkeys").DeleteMany(context.Background(), bson.M{"user_id": user.Id}); err != nil {
+		return err
+	}
+	if err := utils.InvalidateUserSessions(user.Id, nil); err != nil {
+		return err
+	}
+
+	user.EmailVerified = true
+	user.PasswordHash = ""
+	user.MFA = databases.MFASettings{}
+	user.Identities = []databases.Identity{}
+	return nil
+}
+
+// POST "/login/email"
+func MagicLinkLogin(c *fiber.Ctx) error {
+	var body struct {
+		Email      string `json:"email"`
+		ClientId   string `json:"client_id"`
+		RedirectTo string `json:"redirect_to"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Body must contain email.")
+	}
+
+	address, err := mail.ParseAddress(body.Email)
+	if err != nil || address.Address != body.Email {
+		return utils.ErrorResponse(c, 400, "INVALID_EMAIL", "Email is not valid.")
+	}
+
+	if body.ClientId != "" {
+		if _, ok := utils.GetClient(body.ClientId); !ok {
+			return utils.ErrorResponse(c, 400, "INVALID_CLIENT", "Client was not found.")
+		}
+	}
+
+	if body.RedirectTo != "" && !utils.IsAllowedRedirect(body.RedirectTo, body.ClientId) {
+		return utils.ErrorResponse(c, 400, "INVALID_REDIRECT", "Redirect url is not allowed.")
+	}
+
+	// Every request sends an email, so both the inbox and the sender are limited
+	email := strings.ToLower(address.Address)
+	if !utils.CheckRateLimit("magic_link_"+email, 3, time.Minute*15) || !utils.CheckRateLimit("magic_link_ip_"+c.IP(), 10, time.Minute*15) {
+		return utils.ErrorResponse(c, 429, "TOO_MANY_ATTEMPTS", "Too many login links were requested. Try again later.")
+	}
+
+	token, err := utils.RandomId(32)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	link, err := json.Marshal(magicLink{
+		Email:      email,
+		ClientId:   body.ClientId,
+		RedirectTo: body.RedirectTo,
+	})
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	duration, err := time.ParseDuration(os.Getenv("MAGIC_LINK_DURATION"))
+	if err != nil {
+		duration = time.Minute * 15
+	}
+
+	// Only the hash is stored, the token itself is only in the email
+	err = databases.GetRedis().Set(context.Background(), "magic_link_"+utils.HashToken(token), link, duration).Err()
+	if err != nil {
+		log.Println("[Error] Couldn't save magic link: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	loginURL := os.Getenv("CALLBACK_URL") + "/login/email/verify?" + url.Values{"token": {token}}.Encode()
+
+	err = mailer.GetSender().Send(address.Address, "Your login link",
+		"Click the link below to log in. It expires in "+duration.String()+" and can only be used once.\r\n\r\n"+
+			loginURL+"\r\n\r\n"+
+			"If you didn't request this email, you can ignore it.\r\n")
+	if err != nil {
+		log.Println("[Error] Couldn't send magic link: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// GET "/login/email/verify"
+//
+// Mail scanners and link previews open the links in emails, so opening the link only asks the
+// user to confirm the login. The link is used up by the POST the confirmation sends
+func MagicLinkConfirm(c *fiber.Ctx) error {
+	token := c.Query("token", "")
+	if token == "" {
+		return utils.ErrorRedirect(c, 400, "INVALID_LINK", "Login link is invalid or expired.")
+	}
+
+	if confirmURL := os.Getenv("MAGIC_LINK_URL"); confirmURL != "" {
+		return c.Redirect(confirmURL + "?" + url.Values{"token": {token}}.Encode())
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderReferrerPolicy, "no-referrer")
+	c.Type("html")
+	return c.SendString(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Log in</title></head>
+<body>
+<form method="POST" action="/login/email/verify">
+<input type="hidden" name="token" value="` + html.EscapeString(token) + `">
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>`)
+}
+
+// POST "/login/email/verify"
+func MagicLinkVerify(c *fiber.Ctx) error {
+	token := c.FormValue("token", "")
+	if token == "" {
+		return utils.ErrorRedirect(c, 400, "INVALID_LINK", "Login link is invalid or expired.")
+	}
+
+	// GetDel makes the link single-use
+	result, err := databases.GetRedis().GetDel(context.Background(), "magic_link_"+utils.HashToken(token)).Result()
+	if err != nil || result == "" {
+		return utils.ErrorRedirect(c, 400, "INVALID_LINK", "Login link is invalid or expired.")
+	}
+
+	var link magicLink
+	if err := json.Unmarshal([]byte(result), &link); err != nil {
+		return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	db := databases.GetMongoDatabase()
+
+	var user databases.UserInfo
+	err = db.Collection("users").FindOne(context.Background(), bson.M{"email": link.Email}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		user = databases.UserInfo{
+			Id:            uuid.New().String(),
+			Email:         link.Email,
+			EmailVerified: true,
+			Username:      strings.Split(link.Email, "@")[0],
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
+		}
+		_, err = db.Collection("users").InsertOne(context.Background(), &user)
+	} else if err == nil && !user.EmailVerified {
+		// Opening the link proves that the user owns the email, but anyone could have created
+		// the account with it before. Everything the creator set up to log in is removed, so
+		// only the owner of the email keeps access
+		err = claimAccount(&user)
+	}
+	if err != nil {
+		log.Println("[Error] Couldn't find or create user for magic link: \n", err)
+		return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if utils.RequiresMFA(&user) {
+		if _, err := utils.CreatePendingMFA(c, user.Id, "email", link.ClientId, link.RedirectTo); err != nil {
+			return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+		}
+		return utils.MFARedirect(c)
+	}
+
+	if _, err := utils.IssueSession(c, user.Id, "email", link.ClientId); err != nil {
+		return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.Redirect(utils.LoginRedirect(link.ClientId, link.RedirectTo))
+}
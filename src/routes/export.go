@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/x1xo/Auth/src/databases"
+	"github.com/x1xo/Auth/src/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// userExport is the personal data of a user returned by /api/user/export
+type userExport struct {
+	ExportedAt time.Time               `json:"exported_at"`
+	User       databases.UserInfo      `json:"user"`
+	Passkeys   []databases.Passkey     `json:"passkeys"`
+	Sessions   []databases.UserSession `json:"sessions"`
+	AuditLog   []databases.AuditEntry  `json:"audit_log"`
+}
+
+// GET "/api/user/export?format=zip"
+func ExportUser(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+	db := databases.GetMongoDatabase()
+
+	export := userExport{ExportedAt: time.Now()}
+
+	err := db.Collection("users").FindOne(context.Background(), bson.M{"id": session.UserId}).Decode(&export.User)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	export.Passkeys, err = utils.GetPasskeys(session.UserId)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	export.Sessions, err = utils.ListUserSessions(session.UserId)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	cursor, err := db.Collection("audit_log").Find(context.Background(), bson.M{"user_id": session.UserId},
+		options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+	export.AuditLog = []databases.AuditEntry{}
+	if err := cursor.All(context.Background(), &export.AuditLog); err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if c.Query("format", "json") != "zip" {
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="export.json"`)
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(data)
+	}
+
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	file, err := writer.Create("export.json")
+	if err == nil {
+		_, err = file.Write(data)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		log.Println("[Error] Couldn't create export archive: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="export.zip"`)
+	c.Set(fiber.HeaderContentType, "application/zip")
+	return c.Send(archive.Bytes())
+}
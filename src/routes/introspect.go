@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/x1xo/Auth/src/utils"
+)
+
+// POST "/introspect"
+func Introspect(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	// Only confidential clients can introspect, public clients can't keep a secret
+	clientId, clientSecret := clientCredentials(c)
+	client, ok := utils.GetClient(clientId)
+	if !ok || !utils.VerifyClientSecret(client, clientSecret) {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="introspect"`)
+		return oauthError(c, 401, "invalid_client", "Client authentication failed.")
+	}
+
+	token := c.FormValue("token", "")
+	if token == "" {
+		return oauthError(c, 400, "invalid_request", "token is required.")
+	}
+
+	// The session record expires with the session, so a missing record is an inactive token
+	session, err := utils.GetSession(token)
+	if err != nil {
+		return c.JSON(fiber.Map{
+			"active": false,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"active":     true,
+		"sub":        session.UserId,
+		"exp":        session.ExpiresAt.Unix(),
+		"iat":        session.IssuedAt.Unix(),
+		"provider":   session.Provider,
+		"session_id": session.Id,
+		"token_type": "session",
+	})
+}
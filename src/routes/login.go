@@ -2,111 +2,161 @@ package routes
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"log"
 	"os"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/x1xo/Auth/src/databases"
+	"github.com/x1xo/Auth/src/providers"
 	"github.com/x1xo/Auth/src/utils"
 )
 
-var SCOPES = map[string]string{
-	"github":  "user%20user:email%20repo%20repo_deployment",
-	"google":  "profile+email",
-	"discord": "identify%20guilds.join%20email",
-}
-
-func getRedirectURL(provider string) (string, error) {
-	callbackURL := os.Getenv("CALLBACK_URL")
-	if callbackURL == "" {
-		return "", errors.New("callback url not found")
+// GET "/login"
+func Login(c *fiber.Ctx) error {
+	provider, ok := providers.Get(c.Query("provider", "github"))
+	if !ok {
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "PROVIDER_NOT_FOUND",
+				"message": "Provider was not found.",
+			},
+		})
 	}
 
-	var redirectURL string
-	var err error
-
-	switch provider {
-	case "github":
-		clientID := os.Getenv("GITHUB_CLIENT_ID")
-		if clientID == "" {
-			err = errors.New("github client id is not set")
-			break
+	clientId := c.Query("client_id", "")
+	if clientId != "" {
+		if _, ok := utils.GetClient(clientId); !ok {
+			return c.Status(400).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "INVALID_CLIENT",
+					"message": "Client was not found.",
+				},
+			})
 		}
+	}
 
-		redirectURL = "https://github.com/login/oauth/authorize?scope="
-		redirectURL += SCOPES["github"]
-		redirectURL += "&redirect_uri=" + callbackURL + "/callback/github"
-		redirectURL += "&client_id=" + clientID
-
-		return redirectURL, nil
-	case "google":
-		clientID := os.Getenv("GOOGLE_CLIENT_ID")
-		if clientID == "" {
-			err = errors.New("google client id is not set")
-			break
-		}
+	redirectTo := c.Query("redirect_to", "")
+	if redirectTo != "" && !utils.IsAllowedRedirect(redirectTo, clientId) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INVALID_REDIRECT",
+				"message": "Redirect url is not allowed.",
+			},
+		})
+	}
 
-		redirectURL = "https://accounts.google.com/o/oauth2/v2/auth?prompt=consent&response_type=code&access_type=offline"
-		redirectURL += "&scope=" + SCOPES["google"]
-		redirectURL += "&redirect_uri=" + callbackURL + "/callback/google"
-		redirectURL += "&client_id=" + clientID
-	case "discord":
-		clientID := os.Getenv("DISCORD_CLIENT_ID")
-		if clientID == "" {
-			err = errors.New("discord client id is not set")
-			break
+	// Linking attaches the provider to the logged in user instead of logging in
+	linkUserId := ""
+	if c.Query("link", "") == "true" {
+		session, err := utils.GetSession(utils.GetUserToken(c))
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    "UNAUTHENTICATED",
+					"message": "You need to be logged in to link a provider.",
+				},
+			})
 		}
-
-		redirectURL = "https://discord.com/oauth2/authorize?response_type=code&prompt=consent&scope="
-		redirectURL += SCOPES["discord"]
-		redirectURL += "&redirect_uri=" + callbackURL + "/callback/discord"
-		redirectURL += "&client_id=" + clientID
-	default:
-		err = errors.New("provider not found")
+		linkUserId = session.UserId
 	}
 
-	return redirectURL, err
+	redis := databases.GetRedis()
+	state, err := utils.RandomId(8)
+	if err != nil {
+		log.Println(err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong on our side. Try again later.",
+			},
+		})
+	}
 
-}
+	nonce, err := utils.RandomId(16)
+	if err != nil {
+		log.Println(err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong on our side. Try again later.",
+			},
+		})
+	}
 
-func Login(c *fiber.Ctx) error {
-	provider := c.Query("provider", "github")
+	codeVerifier, err := utils.RandomId(32)
+	if err != nil {
+		log.Println(err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": fiber.Map{
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong on our side. Try again later.",
+			},
+		})
+	}
 
-	redirectUri, err := getRedirectURL(provider)
+	browserBinding, err := utils.RandomId(32)
 	if err != nil {
 		log.Println(err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
-				"code":  "PROVIDER_NOT_FOUND",
-				"message": "Provider was not found.",
+				"code":    "INTERNAL_SERVER_ERROR",
+				"message": "Something went wrong on our side. Try again later.",
 			},
 		})
 	}
 
-	redis := databases.GetRedis()
-	state, err := utils.RandomId(8)
+	loginState := databases.LoginState{
+		Provider:       provider.Name(),
+		Nonce:          nonce,
+		CodeVerifier:   codeVerifier,
+		BrowserBinding: utils.HashToken(browserBinding),
+		RedirectTo:     redirectTo,
+		ClientId:       clientId,
+		LinkUserId:     linkUserId,
+	}
+
+	loginStateJSON, err := json.Marshal(loginState)
 	if err != nil {
 		log.Println(err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
-				"code":  "INTERNAL_SERVER_ERROR",
+				"code":    "INTERNAL_SERVER_ERROR",
 				"message": "Something went wrong on our side. Try again later.",
 			},
 		})
 	}
 
-	err = redis.Set(context.Background(), state, provider, time.Minute*10).Err()
+	err = redis.Set(context.Background(), state, loginStateJSON, time.Minute*10).Err()
 	if err != nil {
 		log.Println(err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
-				"code":  "INTERNAL_SERVER_ERROR",
+				"code":    "INTERNAL_SERVER_ERROR",
 				"message": "Something went wrong on our side. Try again later.",
 			},
 		})
 	}
 
-	return c.Redirect(redirectUri + "&state=" + state)
+	secure := os.Getenv("ENVIRONMENT") == "production"
+	sameSite := fiber.CookieSameSiteLaxMode
+	if secure {
+		// form_post callbacks are cross-site POST requests, lax cookies aren't sent with them
+		sameSite = fiber.CookieSameSiteNoneMode
+	}
+
+	// The callback is only accepted from the browser holding this cookie, so a state
+	// started by someone else can't be finished by the victim (login CSRF)
+	c.Cookie(&fiber.Cookie{
+		Name:     utils.LoginStateCookie,
+		Value:    browserBinding,
+		Path:     "/callback",
+		Expires:  time.Now().Add(time.Minute * 10),
+		HTTPOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+	})
+
+	return c.Redirect(provider.AuthURL(state, &loginState))
 }
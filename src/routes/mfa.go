@@ -0,0 +1,345 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/x1xo/Auth/src/databases"
+	"github.com/x1xo/Auth/src/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type mfaRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	MFAToken     string `json:"mfa_token"`
+}
+
+// issueRecoveryCodes replaces the user's recovery codes with a new set
+//
+// returns the plain codes, they are only shown to the user once
+func issueRecoveryCodes(userId string) ([]string, error) {
+	codes, hashes, err := utils.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = databases.GetMongoDatabase().Collection("users").UpdateOne(context.Background(), bson.M{"id": userId}, bson.M{
+		"$set": bson.M{"mfa.recovery_codes": hashes, "updated_at": time.Now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// issueFirstRecoveryCodes generates the recovery codes with the user's first second factor
+//
+// returns the plain codes, or nil when the user already has recovery codes
+func issueFirstRecoveryCodes(user *databases.UserInfo) ([]string, error) {
+	if len(user.MFA.RecoveryCodes) > 0 {
+		return nil, nil
+	}
+
+	codes, err := issueRecoveryCodes(user.Id)
+	if err != nil {
+		log.Println("[Error] Couldn't generate recovery codes: \n", err)
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// useRecoveryCode removes the recovery code from the user, pulling the hash makes it single-use
+//
+// returns false if the user doesn't have the code
+func useRecoveryCode(userId, code string) (bool, error) {
+	result, err := databases.GetMongoDatabase().Collection("users").UpdateOne(context.Background(),
+		bson.M{"id": userId, "mfa.recovery_codes": utils.HashRecoveryCode(code)},
+		bson.M{"$pull": bson.M{"mfa.recovery_codes": utils.HashRecoveryCode(code)}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// clearRecoveryCodes removes the recovery codes once the user has no second factor left
+func clearRecoveryCodes(user *databases.UserInfo) {
+	if utils.RequiresMFA(user) {
+		return
+	}
+
+	databases.GetMongoDatabase().Collection("users").UpdateOne(context.Background(), bson.M{"id": user.Id}, bson.M{
+		"$unset": bson.M{"mfa.recovery_codes": ""},
+	})
+}
+
+// requireMFAProof checks the fresh second factor a sensitive change needs: a code from the
+// authenticator app, a recovery code or a passkey verified with /api/user/mfa/passkey/finish
+//
+// allowRecoveryCode - whether a recovery code is accepted, it's used up by the check
+//
+// returns false when the proof is missing or invalid, the error response is already sent
+func requireMFAProof(c *fiber.Ctx, session *databases.UserSession, user *databases.UserInfo, body *mfaRequest, allowRecoveryCode bool) (bool, error) {
+	if !utils.CheckRateLimit("mfa_attempts_"+user.Id, 5, time.Minute*15) {
+		return false, utils.ErrorResponse(c, 429, "TOO_MANY_ATTEMPTS", "Too many attempts. Try again later.")
+	}
+
+	if body.Code != "" {
+		step, ok := utils.ValidateTOTP(user.MFA.TOTPSecret, body.Code)
+		if !user.MFA.TOTPEnabled || !ok || !utils.UseTOTPStep(user.Id, step) {
+			return false, utils.ErrorResponse(c, 400, "INVALID_CODE", "Code is invalid.")
+		}
+		return true, nil
+	}
+
+	if body.RecoveryCode != "" && allowRecoveryCode {
+		used, err := useRecoveryCode(user.Id, body.RecoveryCode)
+		if err != nil {
+			return false, utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+		}
+		if !used {
+			return false, utils.ErrorResponse(c, 400, "INVALID_CODE", "Recovery code is invalid.")
+		}
+		return true, nil
+	}
+
+	// The passkey verification is used up by the change it was made for
+	if verified, _ := databases.GetRedis().GetDel(context.Background(), "mfa_verified_"+session.Id).Result(); verified != "" {
+		return true, nil
+	}
+
+	return false, utils.ErrorResponse(c, 401, "MFA_REQUIRED", "Confirm the change with your second factor first.")
+}
+
+// POST "/api/user/mfa/totp"
+func EnrollTOTP(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+
+	var user databases.UserInfo
+	err := databases.GetMongoDatabase().Collection("users").FindOne(context.Background(), bson.M{"id": session.UserId}).Decode(&user)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if user.MFA.TOTPEnabled {
+		return utils.ErrorResponse(c, 400, "TOTP_ALREADY_ENABLED", "Authenticator app is already enabled.")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	// The secret is only saved on the user once it's confirmed with a code
+	err = databases.GetRedis().Set(context.Background(), "totp_enroll_"+user.Id, secret, time.Minute*10).Err()
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	issuer := os.Getenv("MFA_ISSUER")
+	if issuer == "" {
+		issuer = "Auth"
+	}
+	account := user.Email
+	if account == "" {
+		account = user.Username
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"secret": secret,
+		"uri":    utils.TOTPURI(secret, account, issuer),
+	})
+}
+
+// POST "/api/user/mfa/totp/confirm"
+func ConfirmTOTP(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+
+	var body mfaRequest
+	if err := c.BodyParser(&body); err != nil || body.Code == "" {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Body must contain code.")
+	}
+
+	if !utils.CheckRateLimit("mfa_attempts_"+session.UserId, 5, time.Minute*15) {
+		return utils.ErrorResponse(c, 429, "TOO_MANY_ATTEMPTS", "Too many attempts. Try again later.")
+	}
+
+	var user databases.UserInfo
+	err := databases.GetMongoDatabase().Collection("users").FindOne(context.Background(), bson.M{"id": session.UserId}).Decode(&user)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	secret, err := databases.GetRedis().Get(context.Background(), "totp_enroll_"+session.UserId).Result()
+	if err != nil || secret == "" {
+		return utils.ErrorResponse(c, 400, "TOTP_NOT_ENROLLED", "Start the authenticator app setup first.")
+	}
+
+	step, ok := utils.ValidateTOTP(secret, body.Code)
+	if !ok || !utils.UseTOTPStep(session.UserId, step) {
+		return utils.ErrorResponse(c, 400, "INVALID_CODE", "Code is invalid.")
+	}
+
+	_, err = databases.GetMongoDatabase().Collection("users").UpdateOne(context.Background(), bson.M{"id": session.UserId}, bson.M{
+		"$set": bson.M{"mfa.totp_enabled": true, "mfa.totp_secret": secret, "updated_at": time.Now()},
+	})
+	if err != nil {
+		log.Println("[Error] Couldn't enable totp: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	databases.GetRedis().Del(context.Background(), "totp_enroll_"+session.UserId)
+
+	recoveryCodes, err := issueFirstRecoveryCodes(&user)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success":        true,
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// DELETE "/api/user/mfa/totp"
+func DisableTOTP(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+
+	var body mfaRequest
+	if err := c.BodyParser(&body); err != nil || body.Code == "" {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Body must contain code.")
+	}
+
+	if !utils.CheckRateLimit("mfa_attempts_"+session.UserId, 5, time.Minute*15) {
+		return utils.ErrorResponse(c, 429, "TOO_MANY_ATTEMPTS", "Too many attempts. Try again later.")
+	}
+
+	var user databases.UserInfo
+	err := databases.GetMongoDatabase().Collection("users").FindOne(context.Background(), bson.M{"id": session.UserId}).Decode(&user)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if !user.MFA.TOTPEnabled {
+		return utils.ErrorResponse(c, 400, "TOTP_NOT_ENABLED", "Authenticator app is not enabled.")
+	}
+
+	step, ok := utils.ValidateTOTP(user.MFA.TOTPSecret, body.Code)
+	if !ok || !utils.UseTOTPStep(user.Id, step) {
+		return utils.ErrorResponse(c, 400, "INVALID_CODE", "Code is invalid.")
+	}
+
+	_, err = databases.GetMongoDatabase().Collection("users").UpdateOne(context.Background(), bson.M{"id": user.Id}, bson.M{
+		"$set":   bson.M{"mfa.totp_enabled": false, "updated_at": time.Now()},
+		"$unset": bson.M{"mfa.totp_secret": ""},
+	})
+	if err != nil {
+		log.Println("[Error] Couldn't disable totp: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	user.MFA.TOTPEnabled = false
+	clearRecoveryCodes(&user)
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// POST "/api/user/mfa/recovery_codes"
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+
+	var body mfaRequest
+	c.BodyParser(&body)
+
+	var user databases.UserInfo
+	err := databases.GetMongoDatabase().Collection("users").FindOne(context.Background(), bson.M{"id": session.UserId}).Decode(&user)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if !utils.RequiresMFA(&user) {
+		return utils.ErrorResponse(c, 400, "MFA_NOT_ENABLED", "Enable a second factor first.")
+	}
+
+	// A session alone must not be enough to get a working set of codes
+	if ok, err := requireMFAProof(c, session, &user, &body, false); !ok {
+		return err
+	}
+
+	// The old set is replaced, so its unused codes stop working
+	recoveryCodes, err := issueRecoveryCodes(user.Id)
+	if err != nil {
+		log.Println("[Error] Couldn't generate recovery codes: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// POST "/mfa/verify"
+func VerifyMFA(c *fiber.Ctx) error {
+	var body mfaRequest
+	if err := c.BodyParser(&body); err != nil || (body.Code == "" && body.RecoveryCode == "") {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Body must contain code or recovery_code.")
+	}
+
+	mfaToken := c.Cookies(utils.MFACookie, body.MFAToken)
+	pending, err := utils.GetPendingMFA(mfaToken)
+	if mfaToken == "" || err != nil {
+		return utils.ErrorResponse(c, 401, "UNAUTHENTICATED", "MFA session is invalid or expired.")
+	}
+
+	if !utils.CheckRateLimit("mfa_attempts_"+pending.UserId, 5, time.Minute*15) {
+		return utils.ErrorResponse(c, 429, "TOO_MANY_ATTEMPTS", "Too many attempts. Try again later.")
+	}
+
+	var user databases.UserInfo
+	err = databases.GetMongoDatabase().Collection("users").FindOne(context.Background(), bson.M{"id": pending.UserId}).Decode(&user)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if body.RecoveryCode != "" {
+		used, err := useRecoveryCode(user.Id, body.RecoveryCode)
+		if err != nil {
+			return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+		}
+		if !used {
+			return utils.ErrorResponse(c, 400, "INVALID_CODE", "Recovery code is invalid.")
+		}
+
+		return completeMFA(c, mfaToken, pending)
+	}
+
+	step, ok := utils.ValidateTOTP(user.MFA.TOTPSecret, body.Code)
+	if !user.MFA.TOTPEnabled || !ok || !utils.UseTOTPStep(user.Id, step) {
+		return utils.ErrorResponse(c, 400, "INVALID_CODE", "Code is invalid.")
+	}
+
+	return completeMFA(c, mfaToken, pending)
+}
+
+// completeMFA issues the real session once the second factor is verified
+func completeMFA(c *fiber.Ctx, mfaToken string, pending *databases.PendingMFA) error {
+	utils.DeletePendingMFA(c, mfaToken)
+
+	session, err := utils.IssueSession(c, pending.UserId, pending.Provider, pending.ClientId)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"session":     session,
+		"redirect_to": utils.LoginRedirect(pending.ClientId, pending.RedirectTo),
+	})
+}
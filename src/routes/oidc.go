@@ -0,0 +1,394 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/x1xo/Auth/src/databases"
+	"github.com/x1xo/Auth/src/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// supportedScopes are the scopes client apps can request, others are ignored
+var supportedScopes = []string{"openid", "profile", "email"}
+
+// oidcTokenDuration is how long the id and access tokens issued on /token are valid
+const oidcTokenDuration = time.Hour
+
+// authorizationCode is saved in redis until the client app exchanges it on /token
+type authorizationCode struct {
+	ClientId      string    `json:"client_id"`
+	RedirectURI   string    `json:"redirect_uri"`
+	UserId        string    `json:"user_id"`
+	SessionId     string    `json:"session_id"`
+	Scope         string    `json:"scope"`
+	Nonce         string    `json:"nonce,omitempty"`
+	CodeChallenge string    `json:"code_challenge,omitempty"`
+	AuthTime      time.Time `json:"auth_time"`
+}
+
+// oidcAccessToken is saved in redis for the access tokens issued on /token
+type oidcAccessToken struct {
+	ClientId  string `json:"client_id"`
+	UserId    string `json:"user_id"`
+	SessionId string `json:"session_id"`
+	Scope     string `json:"scope"`
+}
+
+// oauthError sends the error in the RFC 6749 format that OAuth clients expect
+func oauthError(c *fiber.Ctx, status int, code, description string) error {
+	return c.Status(status).JSON(fiber.Map{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// authorizeRedirect sends the user back to the client app with the parameters added to its redirect uri
+func authorizeRedirect(c *fiber.Ctx, redirectURI string, params url.Values) error {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		return oauthError(c, 400, "invalid_request", "redirect_uri is invalid.")
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	target.RawQuery = query.Encode()
+
+	return c.Redirect(target.String())
+}
+
+// filterScope keeps the scopes of the requested scope the client app is allowed to use,
+// clients without scopes can use every supported scope
+func filterScope(client *databases.Client, scope string) string {
+	allowed := client.Scopes
+	if len(allowed) == 0 {
+		allowed = supportedScopes
+	}
+
+	var granted []string
+	for _, requested := range strings.Fields(scope) {
+		for _, scope := range allowed {
+			if requested == scope {
+				granted = append(granted, requested)
+				break
+			}
+		}
+	}
+	return strings.Join(granted, " ")
+}
+
+// hasScope reports whether the space separated scope contains the scope
+func hasScope(scope, name string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// userClaims returns the standard claims of the user allowed by the scope
+func userClaims(user *databases.UserInfo, scope string) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"sub": user.Id,
+	}
+	if hasScope(scope, "profile") {
+		claims["name"] = user.Username
+		claims["preferred_username"] = user.Username
+		claims["picture"] = user.AvatarURL
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	if hasScope(scope, "email") {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerified
+	}
+	return claims
+}
+
+// sessionExists reports whether the sso session the tokens were issued for wasn't invalidated
+func sessionExists(userId, sessionId string) bool {
+	count, err := databases.GetRedis().Exists(context.Background(), userId+"_"+sessionId).Result()
+	return err == nil && count == 1
+}
+
+// GET "/.well-known/openid-configuration"
+func OpenIDConfiguration(c *fiber.Ctx) error {
+	issuer := utils.IssuerURL()
+
+	return c.JSON(fiber.Map{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      supportedScopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported": []string{
+			"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "sid",
+			"name", "preferred_username", "picture", "updated_at", "email", "email_verified",
+		},
+	})
+}
+
+// GET "/jwks.json"
+func JWKS(c *fiber.Ctx) error {
+	jwks, err := utils.JWKS()
+	if err != nil {
+		log.Println("[Error] Couldn't load signing key: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.JSON(jwks)
+}
+
+// GET "/authorize"
+func Authorize(c *fiber.Ctx) error {
+	// Until the redirect uri is verified errors can't be sent back to the client app
+	client, ok := utils.GetClient(c.Query("client_id", ""))
+	if !ok {
+		return oauthError(c, 400, "invalid_client", "Client was not found.")
+	}
+
+	redirectURI := c.Query("redirect_uri", "")
+	if !utils.HasRedirectURI(client, redirectURI) {
+		return oauthError(c, 400, "invalid_request", "redirect_uri is not registered for the client.")
+	}
+
+	state := c.Query("state", "")
+	fail := func(code, description string) error {
+		params := url.Values{"error": {code}, "error_description": {description}}
+		if state != "" {
+			params.Set("state", state)
+		}
+		return authorizeRedirect(c, redirectURI, params)
+	}
+
+	if c.Query("response_type", "") != "code" {
+		return fail("unsupported_response_type", "Only the code response type is supported.")
+	}
+
+	scope := filterScope(client, c.Query("scope", ""))
+	if !hasScope(scope, "openid") {
+		return fail("invalid_scope", "The openid scope is required.")
+	}
+
+	codeChallenge := c.Query("code_challenge", "")
+	if codeChallenge != "" && c.Query("code_challenge_method", "") != "S256" {
+		return fail("invalid_request", "Only the S256 code challenge method is supported.")
+	}
+	if codeChallenge == "" && client.SecretHash == "" {
+		return fail("invalid_request", "Public clients must use PKCE.")
+	}
+
+	// The session of the service is the sso session, the user only logs in once for every app
+	session, err := utils.GetSession(utils.GetUserToken(c))
+	if err != nil {
+		loginURL := os.Getenv("LOGIN_URL")
+		if loginURL == "" || c.Query("prompt", "") == "none" {
+			return fail("login_required", "The user is not logged in.")
+		}
+		return c.Redirect(loginURL + "?" + url.Values{
+			"client_id":   {client.Id},
+			"redirect_to": {utils.IssuerURL() + c.OriginalURL()},
+		}.Encode())
+	}
+
+	code, err := utils.RandomId(32)
+	if err != nil {
+		return fail("server_error", "Something went wrong on our side. Try again later.")
+	}
+
+	authorization, err := json.Marshal(authorizationCode{
+		ClientId:      client.Id,
+		RedirectURI:   redirectURI,
+		UserId:        session.UserId,
+		SessionId:     session.Id,
+		Scope:         scope,
+		Nonce:         c.Query("nonce", ""),
+		CodeChallenge: codeChallenge,
+		AuthTime:      session.IssuedAt,
+	})
+	if err != nil {
+		return fail("server_error", "Something went wrong on our side. Try again later.")
+	}
+
+	err = databases.GetRedis().Set(context.Background(), "oauth_code_"+utils.HashToken(code), authorization, time.Minute).Err()
+	if err != nil {
+		log.Println("[Error] Couldn't save authorization code: \n", err)
+		return fail("server_error", "Something went wrong on our side. Try again later.")
+	}
+
+	params := url.Values{"code": {code}}
+	if state != "" {
+		params.Set("state", state)
+	}
+	return authorizeRedirect(c, redirectURI, params)
+}
+
+// clientCredentials returns the client id and secret from the basic auth header or the form
+func clientCredentials(c *fiber.Ctx) (string, string) {
+	if authorization, ok := strings.CutPrefix(c.Get("Authorization"), "Basic "); ok {
+		decoded, err := base64.StdEncoding.DecodeString(authorization)
+		if err == nil {
+			if id, secret, ok := strings.Cut(string(decoded), ":"); ok {
+				// Basic auth credentials are form encoded before base64 (RFC 6749 section 2.3.1)
+				id, _ = url.QueryUnescape(id)
+				secret, _ = url.QueryUnescape(secret)
+				return id, secret
+			}
+		}
+	}
+	return c.FormValue("client_id", ""), c.FormValue("client_secret", "")
+}
+
+// POST "/token"
+func Token(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+
+	clientId, clientSecret := clientCredentials(c)
+	client, ok := utils.GetClient(clientId)
+	if !ok || (client.SecretHash != "" && !utils.VerifyClientSecret(client, clientSecret)) {
+		return oauthError(c, 401, "invalid_client", "Client authentication failed.")
+	}
+
+	if c.FormValue("grant_type", "") != "authorization_code" {
+		return oauthError(c, 400, "unsupported_grant_type", "Only the authorization_code grant type is supported.")
+	}
+
+	code := c.FormValue("code", "")
+	if code == "" {
+		return oauthError(c, 400, "invalid_request", "code is required.")
+	}
+
+	// GetDel makes the code single-use
+	result, err := databases.GetRedis().GetDel(context.Background(), "oauth_code_"+utils.HashToken(code)).Result()
+	if err != nil || result == "" {
+		return oauthError(c, 400, "invalid_grant", "Code is invalid or expired.")
+	}
+
+	var authorization authorizationCode
+	if err := json.Unmarshal([]byte(result), &authorization); err != nil {
+		return oauthError(c, 500, "server_error", "Something went wrong on our side. Try again later.")
+	}
+
+	if authorization.ClientId != client.Id || authorization.RedirectURI != c.FormValue("redirect_uri", "") {
+		return oauthError(c, 400, "invalid_grant", "Code was issued to another client or redirect_uri.")
+	}
+
+	if authorization.CodeChallenge != "" {
+		hash := sha256.Sum256([]byte(c.FormValue("code_verifier", "")))
+		challenge := base64.RawURLEncoding.EncodeToString(hash[:])
+		if subtle.ConstantTimeCompare([]byte(challenge), []byte(authorization.CodeChallenge)) != 1 {
+			return oauthError(c, 400, "invalid_grant", "code_verifier doesn't match the code challenge.")
+		}
+	}
+
+	if !sessionExists(authorization.UserId, authorization.SessionId) {
+		return oauthError(c, 400, "invalid_grant", "The session was logged out.")
+	}
+
+	var user databases.UserInfo
+	err = databases.GetMongoDatabase().Collection("users").FindOne(context.Background(), bson.M{"id": authorization.UserId}).Decode(&user)
+	if err != nil {
+		return oauthError(c, 400, "invalid_grant", "User was not found.")
+	}
+
+	accessToken, err := utils.RandomId(32)
+	if err != nil {
+		return oauthError(c, 500, "server_error", "Something went wrong on our side. Try again later.")
+	}
+
+	accessTokenJSON, err := json.Marshal(oidcAccessToken{
+		ClientId:  client.Id,
+		UserId:    user.Id,
+		SessionId: authorization.SessionId,
+		Scope:     authorization.Scope,
+	})
+	if err != nil {
+		return oauthError(c, 500, "server_error", "Something went wrong on our side. Try again later.")
+	}
+
+	err = databases.GetRedis().Set(context.Background(), "oauth_access_"+utils.HashToken(accessToken), accessTokenJSON, oidcTokenDuration).Err()
+	if err != nil {
+		log.Println("[Error] Couldn't save access token: \n", err)
+		return oauthError(c, 500, "server_error", "Something went wrong on our side. Try again later.")
+	}
+
+	now := time.Now()
+	claims := userClaims(&user, authorization.Scope)
+	claims["iss"] = utils.IssuerURL()
+	claims["aud"] = client.Id
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(oidcTokenDuration).Unix()
+	claims["auth_time"] = authorization.AuthTime.Unix()
+	claims["sid"] = authorization.SessionId
+	if authorization.Nonce != "" {
+		claims["nonce"] = authorization.Nonce
+	}
+
+	idToken, err := utils.SignToken(claims, "JWT")
+	if err != nil {
+		log.Println("[Error] Couldn't sign id token: \n", err)
+		return oauthError(c, 500, "server_error", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.JSON(fiber.Map{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(oidcTokenDuration.Seconds()),
+		"id_token":     idToken,
+		"scope":        authorization.Scope,
+	})
+}
+
+// GET, POST "/userinfo"
+func UserInfo(c *fiber.Ctx) error {
+	accessToken, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return oauthError(c, 401, "invalid_token", "Access token is missing.")
+	}
+
+	result, err := databases.GetRedis().Get(context.Background(), "oauth_access_"+utils.HashToken(accessToken)).Result()
+	if err != nil || result == "" {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return oauthError(c, 401, "invalid_token", "Access token is invalid or expired.")
+	}
+
+	var token oidcAccessToken
+	if err := json.Unmarshal([]byte(result), &token); err != nil {
+		return oauthError(c, 500, "server_error", "Something went wrong on our side. Try again later.")
+	}
+
+	// Logging out of the sso session revokes the access tokens issued for it
+	if !sessionExists(token.UserId, token.SessionId) {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return oauthError(c, 401, "invalid_token", "The session was logged out.")
+	}
+
+	var user databases.UserInfo
+	err = databases.GetMongoDatabase().Collection("users").FindOne(context.Background(), bson.M{"id": token.UserId}).Decode(&user)
+	if err != nil {
+		return oauthError(c, 401, "invalid_token", "User was not found.")
+	}
+
+	return c.JSON(userClaims(&user, token.Scope))
+}
@@ -0,0 +1,425 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/x1xo/Auth/src/databases"
+	"github.com/x1xo/Auth/src/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// saveCeremony saves the webauthn session data until the ceremony is finished
+func saveCeremony(key string, sessionData *webauthn.SessionData) error {
+	data, err := json.Marshal(sessionData)
+	if err != nil {
+		return err
+	}
+	return databases.GetRedis().Set(context.Background(), "webauthn_"+key, data, time.Minute*5).Err()
+}
+
+// loadCeremony returns and removes the webauthn session data, so a challenge can only be used once
+func loadCeremony(key string) (*webauthn.SessionData, error) {
+	result, err := databases.GetRedis().GetDel(context.Background(), "webauthn_"+key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionData webauthn.SessionData
+	if err := json.Unmarshal([]byte(result), &sessionData); err != nil {
+		return nil, err
+	}
+	return &sessionData, nil
+}
+
+// usePasskey saves the new signature counter of the passkey after a login
+func usePasskey(credential *webauthn.Credential) {
+	if credential.Authenticator.CloneWarning {
+		log.Printf("[Warning] Signature counter of passkey %x went backwards, it may be cloned", credential.ID)
+	}
+
+	databases.GetMongoDatabase().Collection("passkeys").UpdateOne(context.Background(),
+		bson.M{"credential.id": credential.ID},
+		bson.M{"$set": bson.M{
+			"credential.authenticator.signcount":    credential.Authenticator.SignCount,
+			"credential.authenticator.clonewarning": credential.Authenticator.CloneWarning,
+			"last_used_at":                          time.Now(),
+		}},
+	)
+}
+
+// POST "/api/user/passkeys/register/begin"
+func BeginPasskeyRegistration(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+
+	w, err := utils.GetWebAuthn()
+	if err != nil {
+		log.Println("[Error] WebAuthn is not configured: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	user, err := utils.LoadWebAuthnUser(session.UserId)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.Passkeys))
+	for _, credential := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	// Resident keys are required so the passkey can be used without entering an email first
+	options, sessionData, err := w.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		log.Println("[Error] Couldn't begin passkey registration: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if err := saveCeremony("registration_"+session.UserId, sessionData); err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.JSON(options)
+}
+
+// POST "/api/user/passkeys/register/finish?name=<name>"
+func FinishPasskeyRegistration(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+
+	w, err := utils.GetWebAuthn()
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	sessionData, err := loadCeremony("registration_" + session.UserId)
+	if err != nil {
+		return utils.ErrorResponse(c, 400, "INVALID_CHALLENGE", "Passkey registration was not started or expired.")
+	}
+
+	user, err := utils.LoadWebAuthnUser(session.UserId)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	response, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(c.Body()))
+	if err != nil {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Passkey response is invalid.")
+	}
+
+	credential, err := w.CreateCredential(user, *sessionData, response)
+	if err != nil {
+		log.Println("[Error] Couldn't verify passkey registration: \n", err)
+		return utils.ErrorResponse(c, 400, "INVALID_PASSKEY", "Passkey couldn't be verified.")
+	}
+
+	name := c.Query("name", "")
+	if name == "" {
+		name = "Passkey"
+	}
+
+	passkey := databases.Passkey{
+		Id:         uuid.New().String(),
+		UserId:     session.UserId,
+		Name:       name,
+		Credential: *credential,
+		CreatedAt:  time.Now(),
+	}
+
+	if _, err := databases.GetMongoDatabase().Collection("passkeys").InsertOne(context.Background(), &passkey); err != nil {
+		log.Println("[Error] Couldn't save passkey: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	recoveryCodes, err := issueFirstRecoveryCodes(user.User)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"passkey":        passkey,
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// GET "/api/user/passkeys"
+func GetPasskeys(c *fiber.Ctx) error {
+	passkeys, err := utils.GetPasskeys(utils.CurrentSession(c).UserId)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.JSON(passkeys)
+}
+
+// DELETE "/api/user/passkeys/:passkeyId"
+func DeletePasskey(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+
+	var body mfaRequest
+	c.BodyParser(&body)
+
+	var user databases.UserInfo
+	err := databases.GetMongoDatabase().Collection("users").FindOne(context.Background(), bson.M{"id": session.UserId}).Decode(&user)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	passkeys, err := databases.GetMongoDatabase().Collection("passkeys").CountDocuments(context.Background(), bson.M{"user_id": session.UserId})
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	// Removing the last second factor turns MFA off, so it needs a fresh proof like disabling the authenticator app
+	if !user.MFA.TOTPEnabled && passkeys == 1 {
+		if ok, err := requireMFAProof(c, session, &user, &body, true); !ok {
+			return err
+		}
+	}
+
+	result, err := databases.GetMongoDatabase().Collection("passkeys").DeleteOne(context.Background(), bson.M{
+		"id":      c.Params("passkeyId", ""),
+		"user_id": session.UserId,
+	})
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+	if result.DeletedCount == 0 {
+		return utils.ErrorResponse(c, 404, "NOT_FOUND", "Passkey was not found.")
+	}
+
+	clearRecoveryCodes(&user)
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// POST "/api/user/mfa/passkey/begin"
+func BeginPasskeyReauth(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+
+	w, err := utils.GetWebAuthn()
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	user, err := utils.LoadWebAuthnUser(session.UserId)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+	if len(user.Passkeys) == 0 {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Account has no passkeys.")
+	}
+
+	options, sessionData, err := w.BeginLogin(user, webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if err := saveCeremony("reauth_"+session.Id, sessionData); err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.JSON(options)
+}
+
+// POST "/api/user/mfa/passkey/finish"
+func FinishPasskeyReauth(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+
+	if !utils.CheckRateLimit("mfa_attempts_"+session.UserId, 5, time.Minute*15) {
+		return utils.ErrorResponse(c, 429, "TOO_MANY_ATTEMPTS", "Too many attempts. Try again later.")
+	}
+
+	w, err := utils.GetWebAuthn()
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	sessionData, err := loadCeremony("reauth_" + session.Id)
+	if err != nil {
+		return utils.ErrorResponse(c, 400, "INVALID_CHALLENGE", "Passkey verification was not started or expired.")
+	}
+
+	user, err := utils.LoadWebAuthnUser(session.UserId)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	response, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(c.Body()))
+	if err != nil {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Passkey response is invalid.")
+	}
+
+	credential, err := w.ValidateLogin(user, *sessionData, response)
+	if err != nil {
+		log.Println("[Error] Couldn't verify passkey: \n", err)
+		return utils.ErrorResponse(c, 400, "INVALID_PASSKEY", "Passkey couldn't be verified.")
+	}
+
+	usePasskey(credential)
+
+	// Only this session can use the verification, for the next sensitive change within 5 minutes
+	if err := databases.GetRedis().Set(context.Background(), "mfa_verified_"+session.Id, 1, time.Minute*5).Err(); err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// POST "/login/passkey/begin"
+func BeginPasskeyLogin(c *fiber.Ctx) error {
+	w, err := utils.GetWebAuthn()
+	if err != nil {
+		log.Println("[Error] WebAuthn is not configured: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	options, sessionData, err := w.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	challengeId, err := utils.RandomId(16)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if err := saveCeremony("login_"+challengeId, sessionData); err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.JSON(fiber.Map{
+		"challenge_id": challengeId,
+		"options":      options,
+	})
+}
+
+// POST "/login/passkey/finish?challenge_id=<id>"
+func FinishPasskeyLogin(c *fiber.Ctx) error {
+	w, err := utils.GetWebAuthn()
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	sessionData, err := loadCeremony("login_" + c.Query("challenge_id", ""))
+	if err != nil {
+		return utils.ErrorResponse(c, 400, "INVALID_CHALLENGE", "Passkey login was not started or expired.")
+	}
+
+	response, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(c.Body()))
+	if err != nil {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Passkey response is invalid.")
+	}
+
+	var user *utils.WebAuthnUser
+	credential, err := w.ValidateDiscoverableLogin(func(rawId, userHandle []byte) (webauthn.User, error) {
+		user, err = utils.LoadWebAuthnUser(string(userHandle))
+		return user, err
+	}, *sessionData, response)
+	if err != nil {
+		log.Println("[Error] Couldn't verify passkey login: \n", err)
+		return utils.ErrorResponse(c, 401, "INVALID_PASSKEY", "Passkey couldn't be verified.")
+	}
+
+	usePasskey(credential)
+
+	// The passkey was verified with user verification, it's already a second factor
+	session, err := utils.IssueSession(c, user.User.Id, "passkey", c.Query("client_id", ""))
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.JSON(session)
+}
+
+// POST "/mfa/passkey/begin"
+func BeginPasskeyMFA(c *fiber.Ctx) error {
+	var body mfaRequest
+	c.BodyParser(&body)
+
+	mfaToken := c.Cookies(utils.MFACookie, body.MFAToken)
+	pending, err := utils.GetPendingMFA(mfaToken)
+	if mfaToken == "" || err != nil {
+		return utils.ErrorResponse(c, 401, "UNAUTHENTICATED", "MFA session is invalid or expired.")
+	}
+
+	w, err := utils.GetWebAuthn()
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	user, err := utils.LoadWebAuthnUser(pending.UserId)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+	if len(user.Passkeys) == 0 {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Account has no passkeys.")
+	}
+
+	options, sessionData, err := w.BeginLogin(user)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if err := saveCeremony("mfa_"+pending.UserId, sessionData); err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.JSON(options)
+}
+
+// POST "/mfa/passkey/finish"
+func FinishPasskeyMFA(c *fiber.Ctx) error {
+	mfaToken := c.Cookies(utils.MFACookie, c.Query("mfa_token", ""))
+	pending, err := utils.GetPendingMFA(mfaToken)
+	if mfaToken == "" || err != nil {
+		return utils.ErrorResponse(c, 401, "UNAUTHENTICATED", "MFA session is invalid or expired.")
+	}
+
+	if !utils.CheckRateLimit("mfa_attempts_"+pending.UserId, 5, time.Minute*15) {
+		return utils.ErrorResponse(c, 429, "TOO_MANY_ATTEMPTS", "Too many attempts. Try again later.")
+	}
+
+	w, err := utils.GetWebAuthn()
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	sessionData, err := loadCeremony("mfa_" + pending.UserId)
+	if err != nil {
+		return utils.ErrorResponse(c, 400, "INVALID_CHALLENGE", "Passkey verification was not started or expired.")
+	}
+
+	user, err := utils.LoadWebAuthnUser(pending.UserId)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	response, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(c.Body()))
+	if err != nil {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Passkey response is invalid.")
+	}
+
+	credential, err := w.ValidateLogin(user, *sessionData, response)
+	if err != nil {
+		log.Println("[Error] Couldn't verify passkey: \n", err)
+		return utils.ErrorResponse(c, 400, "INVALID_PASSKEY", "Passkey couldn't be verified.")
+	}
+
+	usePasskey(credential)
+
+	return completeMFA(c, mfaToken, pending)
+}
@@ -0,0 +1,167 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/x1xo/Auth/src/databases"
+	"github.com/x1xo/Auth/src/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type passwordRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Username string `json:"username"`
+}
+
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+// getDummyPasswordHash returns the hash verified when the user doesn't exist, so the response
+// time doesn't reveal which emails have an account. It's created on first use, after the
+// .env file is loaded, so it uses the configured argon2 parameters like the real hashes
+func getDummyPasswordHash() string {
+	dummyPasswordHashOnce.Do(func() {
+		hash, err := utils.HashPassword("dummy password")
+		if err != nil {
+			log.Println("[Error] Couldn't hash dummy password: \n", err)
+			return
+		}
+		dummyPasswordHash = hash
+	})
+	return dummyPasswordHash
+}
+
+// POST "/register"
+func Register(c *fiber.Ctx) error {
+	var body passwordRequest
+	if err := c.BodyParser(&body); err != nil {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Body must contain email and password.")
+	}
+
+	address, err := mail.ParseAddress(body.Email)
+	if err != nil || address.Address != body.Email {
+		return utils.ErrorResponse(c, 400, "INVALID_EMAIL", "Email is not valid.")
+	}
+	email := strings.ToLower(address.Address)
+
+	if len(body.Password) < 8 || len(body.Password) > 128 {
+		return utils.ErrorResponse(c, 400, "INVALID_PASSWORD", "Password must be between 8 and 128 characters long.")
+	}
+
+	username := strings.TrimSpace(body.Username)
+	if username == "" {
+		username = strings.Split(email, "@")[0]
+	}
+
+	db := databases.GetMongoDatabase()
+
+	err = db.Collection("users").FindOne(context.Background(), bson.M{"email": email}).Err()
+	if err == nil {
+		return utils.ErrorResponse(c, 409, "EMAIL_TAKEN", "An account with this email already exists.")
+	}
+	if err != mongo.ErrNoDocuments {
+		log.Println("[Error] Couldn't find user by email: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	passwordHash, err := utils.HashPassword(body.Password)
+	if err != nil {
+		log.Println("[Error] Couldn't hash password: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	user := databases.UserInfo{
+		Id:           uuid.New().String(),
+		Email:        email,
+		Username:     username,
+		PasswordHash: passwordHash,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	// The unique email index catches registrations racing past the check above
+	if _, err := db.Collection("users").InsertOne(context.Background(), &user); mongo.IsDuplicateKeyError(err) {
+		return utils.ErrorResponse(c, 409, "EMAIL_TAKEN", "An account with this email already exists.")
+	} else if err != nil {
+		log.Println("[Error] Couldn't insert user: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	session, err := utils.IssueSession(c, user.Id, "password", c.Query("client_id", ""))
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.Status(201).JSON(session)
+}
+
+// POST "/login/password"
+func PasswordLogin(c *fiber.Ctx) error {
+	var body passwordRequest
+	if err := c.BodyParser(&body); err != nil || body.Email == "" || body.Password == "" {
+		return utils.ErrorResponse(c, 400, "INVALID_REQUEST", "Body must contain email and password.")
+	}
+
+	db := databases.GetMongoDatabase()
+
+	var user databases.UserInfo
+	err := db.Collection("users").FindOne(context.Background(), bson.M{"email": strings.ToLower(body.Email)}).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Println("[Error] Couldn't find user by email: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if user.PasswordHash == "" {
+		utils.VerifyPassword(body.Password, getDummyPasswordHash())
+		return utils.ErrorResponse(c, 401, "INVALID_CREDENTIALS", "Email or password is incorrect.")
+	}
+
+	matches, needsRehash, err := utils.VerifyPassword(body.Password, user.PasswordHash)
+	if err != nil {
+		log.Println("[Error] Couldn't verify password: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+	if !matches {
+		return utils.ErrorResponse(c, 401, "INVALID_CREDENTIALS", "Email or password is incorrect.")
+	}
+
+	// The argon2 parameters changed since the password was hashed
+	if needsRehash {
+		if passwordHash, err := utils.HashPassword(body.Password); err == nil {
+			go func() {
+				db.Collection("users").UpdateOne(context.Background(), bson.M{"id": user.Id}, bson.M{
+					"$set": bson.M{"password_hash": passwordHash, "updated_at": time.Now()},
+				})
+			}()
+		}
+	}
+
+	if utils.RequiresMFA(&user) {
+		mfaToken, err := utils.CreatePendingMFA(c, user.Id, "password", c.Query("client_id", ""), "")
+		if err != nil {
+			return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+		}
+		return c.Status(200).JSON(fiber.Map{
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+		})
+	}
+
+	session, err := utils.IssueSession(c, user.Id, "password", c.Query("client_id", ""))
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.JSON(session)
+}
@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/x1xo/Auth/src/databases"
+	"github.com/x1xo/Auth/src/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// linkedProviders returns the names of the providers linked to the user
+func linkedProviders(user *databases.UserInfo) map[string]bool {
+	linked := map[string]bool{}
+	for _, identity := range user.Identities {
+		linked[identity.Provider] = true
+	}
+	return linked
+}
+
+// DELETE "/api/user/providers/:provider?revoke_sessions=true"
+func UnlinkProvider(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+	providerName := c.Params("provider", "")
+
+	db := databases.GetMongoDatabase()
+
+	var user databases.UserInfo
+	err := db.Collection("users").FindOne(context.Background(), bson.M{"id": session.UserId}).Decode(&user)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	linked := linkedProviders(&user)
+	if !linked[providerName] {
+		return utils.ErrorResponse(c, 404, "NOT_FOUND", "Provider is not linked to the account.")
+	}
+
+	passkeys, err := db.Collection("passkeys").CountDocuments(context.Background(), bson.M{"user_id": user.Id})
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	// A verified email can still log in with a magic link
+	if len(linked) == 1 && user.PasswordHash == "" && passkeys == 0 && !user.EmailVerified {
+		return utils.ErrorResponse(c, 400, "LAST_LOGIN_METHOD", "The account would have no way to log in left.")
+	}
+
+	_, err = db.Collection("users").UpdateOne(context.Background(), bson.M{"id": user.Id}, bson.M{
+		"$pull": bson.M{"identities": bson.M{"provider": providerName}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	})
+	if err != nil {
+		log.Println("[Error] Couldn't unlink provider: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	utils.Audit(c, user.Id, utils.AuditProviderUnlinked, providerName)
+
+	if c.Query("revoke_sessions", "") == "true" {
+		err := utils.InvalidateUserSessions(user.Id, func(s *databases.UserSession) bool {
+			return s.Provider == providerName
+		})
+		if err != nil {
+			log.Println("[Error] Couldn't revoke provider sessions: \n", err)
+			return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+		}
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+	})
+}
@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/x1xo/Auth/src/databases"
+	"github.com/x1xo/Auth/src/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// accessTokenDuration returns ACCESS_TOKEN_TTL kept between 5 and 15 minutes, 10 minutes by default
+func accessTokenDuration() time.Duration {
+	duration, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_TTL"))
+	if err != nil {
+		return time.Minute * 10
+	}
+	if duration < time.Minute*5 {
+		return time.Minute * 5
+	}
+	if duration > time.Minute*15 {
+		return time.Minute * 15
+	}
+	return duration
+}
+
+// accessTokenAudience returns ACCESS_TOKEN_AUDIENCE, the issuer by default
+func accessTokenAudience() string {
+	if audience := os.Getenv("ACCESS_TOKEN_AUDIENCE"); audience != "" {
+		return audience
+	}
+	return utils.IssuerURL()
+}
+
+// POST "/api/user/token"
+func IssueAccessToken(c *fiber.Ctx) error {
+	// RequireSession already checked that the session wasn't invalidated, so
+	// revoking the session stops new access tokens from being issued
+	session := utils.CurrentSession(c)
+
+	var user databases.UserInfo
+	err := databases.GetMongoDatabase().Collection("users").FindOne(context.Background(), bson.M{"id": session.UserId}).Decode(&user)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	roles := user.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+
+	now := time.Now()
+	duration := accessTokenDuration()
+	// The token can't outlive the session it was issued for
+	if expiresAt := now.Add(duration); expiresAt.After(session.ExpiresAt) {
+		duration = session.ExpiresAt.Sub(now)
+	}
+
+	accessToken, err := utils.SignToken(jwt.MapClaims{
+		"iss":   utils.IssuerURL(),
+		"aud":   accessTokenAudience(),
+		"sub":   user.Id,
+		"sid":   session.Id,
+		"roles": roles,
+		"jti":   uuid.New().String(),
+		"iat":   now.Unix(),
+		"exp":   now.Add(duration).Unix(),
+	}, "at+jwt")
+	if err != nil {
+		log.Println("[Error] Couldn't sign access token: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	return c.JSON(fiber.Map{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(duration.Seconds()),
+	})
+}
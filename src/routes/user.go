@@ -3,6 +3,9 @@ package routes
 import (
 	"context"
 	"encoding/json"
+	"log"
+	"os"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/x1xo/Auth/src/databases"
@@ -22,8 +25,8 @@ func GetUser(c *fiber.Ctx) error {
 		})
 	}
 
-	result, err := databases.GetRedis().Get(context.Background(), token).Result()
-	if result == "" || err != nil {
+	userSession, err := utils.GetSession(token)
+	if err != nil {
 		return c.Status(401).JSON(fiber.Map{
 			"error": fiber.Map{
 				"code":    "UNAUTHENTICATED",
@@ -32,17 +35,6 @@ func GetUser(c *fiber.Ctx) error {
 		})
 	}
 
-	var userSession databases.UserSession
-	err = json.Unmarshal([]byte(result), &userSession)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": fiber.Map{
-				"code":    "INTERNAL_SERVER_ERROR",
-				"message": "Something went wrong on our side. Try again later.",
-			},
-		})
-	}
-
 	var userInfo databases.UserInfo
 	err = databases.GetMongoDatabase().Collection("users").FindOne(context.Background(), bson.M{"id": userSession.UserId}).Decode(&userInfo)
 	if err != nil {
@@ -69,8 +61,8 @@ func GetUserSessions(c *fiber.Ctx) error {
 		})
 	}
 
-	result, err := databases.GetRedis().Get(context.Background(), token).Result()
-	if result == "" || err != nil {
+	currentSession, err := utils.GetSession(token)
+	if err != nil {
 		return c.Status(401).JSON(fiber.Map{
 			"error": fiber.Map{
 				"code":    "UNAUTHENTICATED",
@@ -79,17 +71,6 @@ func GetUserSessions(c *fiber.Ctx) error {
 		})
 	}
 
-	var currentSession databases.UserSession
-	err = json.Unmarshal([]byte(result), &currentSession)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": fiber.Map{
-				"code":    "INTERNAL_SERVER_ERROR",
-				"message": "Something went wrong on our side. Try again later.",
-			},
-		})
-	}
-
 	/* var userSessions []databases.UserSession */
 
 	var sessions []string
@@ -161,8 +142,8 @@ func InvalidateSession(c *fiber.Ctx) error {
 		})
 	}
 
-	result, err := databases.GetRedis().Get(context.Background(), token).Result()
-	if result == "" || err != nil {
+	currentSession, err := utils.GetSession(token)
+	if err != nil {
 		return c.Status(401).JSON(fiber.Map{
 			"error": fiber.Map{
 				"code":    "UNAUTHENTICATED",
@@ -171,17 +152,6 @@ func InvalidateSession(c *fiber.Ctx) error {
 		})
 	}
 
-	var currentSession databases.UserSession
-	err = json.Unmarshal([]byte(result), &currentSession)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": fiber.Map{
-				"code":    "INTERNAL_SERVER_ERROR",
-				"message": "Something went wrong on our side. Try again later.",
-			},
-		})
-	}
-
 	sessionToken, err := databases.GetRedis().Get(context.Background(), currentSession.UserId+"_"+sessionId).Result()
 	if sessionToken == "" || err != nil {
 		return c.Status(404).JSON(fiber.Map{
@@ -235,8 +205,8 @@ func InvalidateAllSessions(c *fiber.Ctx) error {
 		})
 	}
 
-	result, err := databases.GetRedis().Get(context.Background(), token).Result()
-	if result == "" || err != nil {
+	currentSession, err := utils.GetSession(token)
+	if err != nil {
 		return c.Status(401).JSON(fiber.Map{
 			"error": fiber.Map{
 				"code":    "UNAUTHENTICATED",
@@ -245,8 +215,7 @@ func InvalidateAllSessions(c *fiber.Ctx) error {
 		})
 	}
 
-	var currentSession databases.UserSession
-	err = json.Unmarshal([]byte(result), &currentSession)
+	err = utils.InvalidateUserSessions(currentSession.UserId, nil)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": fiber.Map{
@@ -256,46 +225,80 @@ func InvalidateAllSessions(c *fiber.Ctx) error {
 		})
 	}
 
-	sessionIds, err := databases.GetRedis().Keys(context.Background(), currentSession.UserId+"_*").Result()
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+	})
+
+}
+
+// DELETE "/api/user"
+func DeleteUser(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+
+	reauthWindow, err := time.ParseDuration(os.Getenv("REAUTH_WINDOW"))
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": fiber.Map{
-				"code":    "INTERNAL_SERVER_ERROR",
-				"message": "Something went wrong on our side. Try again later.",
-			},
-		})
+		reauthWindow = time.Minute * 10
 	}
 
-	sessionTokens, err := databases.GetRedis().MGet(context.Background(), sessionIds...).Result()
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": fiber.Map{
-				"code":    "INTERNAL_SERVER_ERROR",
-				"message": "Something went wrong on our side. Try again later.",
-			},
+	// A stolen or forgotten session shouldn't be enough to delete the account
+	if time.Since(session.IssuedAt) > reauthWindow {
+		return utils.ErrorResponse(c, 403, "REAUTHENTICATION_REQUIRED", "Log in again to delete the account.")
+	}
+
+	grace := utils.GetDeletionGrace()
+	if grace == 0 {
+		if err := utils.DeleteUser(session.UserId); err != nil {
+			log.Println("[Error] Couldn't delete user: \n", err)
+			return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+		}
+
+		return c.Status(200).JSON(fiber.Map{
+			"success": true,
 		})
 	}
 
-	pipe := databases.GetRedis().Pipeline()
-	for i := 0; i < len(sessionTokens); i++ {
-		pipe.Del(context.Background(), sessionTokens[i].(string))
+	deletionAt := time.Now().Add(grace)
+	_, err = databases.GetMongoDatabase().Collection("users").UpdateOne(context.Background(), bson.M{"id": session.UserId}, bson.M{
+		"$set": bson.M{"deletion_scheduled_at": deletionAt, "updated_at": time.Now()},
+	})
+	if err != nil {
+		log.Println("[Error] Couldn't schedule user deletion: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
 	}
-	for i := 0; i < len(sessionIds); i++ {
-		pipe.Del(context.Background(), sessionIds[i])
+
+	if err := utils.InvalidateUserSessions(session.UserId, nil); err != nil {
+		log.Println("[Error] Couldn't invalidate sessions: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
 	}
+	utils.Audit(c, session.UserId, utils.AuditDeletionScheduled, "")
 
-	_, err = pipe.Exec(context.Background())
+	return c.Status(200).JSON(fiber.Map{
+		"success":               true,
+		"deletion_scheduled_at": deletionAt,
+	})
+}
+
+// POST "/api/user/deletion/cancel"
+func CancelUserDeletion(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+
+	result, err := databases.GetMongoDatabase().Collection("users").UpdateOne(context.Background(),
+		bson.M{"id": session.UserId, "deletion_scheduled_at": bson.M{"$exists": true}},
+		bson.M{
+			"$unset": bson.M{"deletion_scheduled_at": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		},
+	)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": fiber.Map{
-				"code":    "INTERNAL_SERVER_ERROR",
-				"message": "Something went wrong on our side. Try again later.",
-			},
-		})
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrorResponse(c, 404, "NOT_FOUND", "Account is not scheduled for deletion.")
 	}
 
+	utils.Audit(c, session.UserId, utils.AuditDeletionCancelled, "")
+
 	return c.Status(200).JSON(fiber.Map{
 		"success": true,
 	})
-
 }
@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/x1xo/Auth/src/databases"
+	mailer "github.com/x1xo/Auth/src/mail"
+	"github.com/x1xo/Auth/src/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type emailVerification struct {
+	UserId string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// POST "/api/user/email/verify"
+func SendEmailVerification(c *fiber.Ctx) error {
+	session := utils.CurrentSession(c)
+
+	var user databases.UserInfo
+	err := databases.GetMongoDatabase().Collection("users").FindOne(context.Background(), bson.M{"id": session.UserId}).Decode(&user)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	if user.EmailVerified {
+		return utils.ErrorResponse(c, 400, "EMAIL_ALREADY_VERIFIED", "Email is already verified.")
+	}
+	if user.Email == "" {
+		return utils.ErrorResponse(c, 400, "INVALID_EMAIL", "Account has no email.")
+	}
+
+	token, err := utils.RandomId(32)
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	verification, err := json.Marshal(emailVerification{
+		UserId: user.Id,
+		Email:  user.Email,
+	})
+	if err != nil {
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	err = databases.GetRedis().Set(context.Background(), "email_verification_"+utils.HashToken(token), verification, time.Hour*24).Err()
+	if err != nil {
+		log.Println("[Error] Couldn't save email verification: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	verifyURL := os.Getenv("CALLBACK_URL") + "/api/user/email/verify/confirm?" + url.Values{"token": {token}}.Encode()
+
+	err = mailer.GetSender().Send(user.Email, "Verify your email",
+		"Click the link below to verify your email. It expires in 24 hours.\r\n\r\n"+
+			verifyURL+"\r\n\r\n"+
+			"If you didn't request this email, you can ignore it.\r\n")
+	if err != nil {
+		log.Println("[Error] Couldn't send email verification: \n", err)
+		return utils.ErrorResponse(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// GET "/api/user/email/verify/confirm"
+func ConfirmEmailVerification(c *fiber.Ctx) error {
+	token := c.Query("token", "")
+	if token == "" {
+		return utils.ErrorRedirect(c, 400, "INVALID_LINK", "Verification link is invalid or expired.")
+	}
+
+	key := "email_verification_" + utils.HashToken(token)
+	result, err := databases.GetRedis().Get(context.Background(), key).Result()
+	if err != nil || result == "" {
+		return utils.ErrorRedirect(c, 400, "INVALID_LINK", "Verification link is invalid or expired.")
+	}
+
+	var verification emailVerification
+	if err := json.Unmarshal([]byte(result), &verification); err != nil {
+		return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+
+	// Anyone can register with someone else's email and request the link, so it only
+	// verifies the email when it's opened with a session of the account that requested it
+	session, err := utils.GetSession(utils.GetUserToken(c))
+	if err != nil || session.UserId != verification.UserId {
+		return utils.ErrorRedirect(c, 401, "UNAUTHENTICATED", "Log in to the account before opening the verification link.")
+	}
+
+	// Deleting the link only now keeps it usable when it was opened in another browser first
+	if deleted, err := databases.GetRedis().Del(context.Background(), key).Result(); err != nil || deleted == 0 {
+		return utils.ErrorRedirect(c, 400, "INVALID_LINK", "Verification link is invalid or expired.")
+	}
+
+	// The email must not have changed since the link was sent
+	updated, err := databases.GetMongoDatabase().Collection("users").UpdateOne(context.Background(),
+		bson.M{"id": verification.UserId, "email": verification.Email},
+		bson.M{"$set": bson.M{"email_verified": true, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		log.Println("[Error] Couldn't verify email: \n", err)
+		return utils.ErrorRedirect(c, 500, "INTERNAL_SERVER_ERROR", "Something went wrong on our side. Try again later.")
+	}
+	if updated.MatchedCount == 0 {
+		return utils.ErrorRedirect(c, 400, "INVALID_LINK", "Verification link is invalid or expired.")
+	}
+
+	return c.Redirect(os.Getenv("REDIRECT_URL"))
+}
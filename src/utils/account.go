@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/x1xo/Auth/src/databases"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetDeletionGrace returns how long deleted accounts can still be restored, 0 deletes them right away
+func GetDeletionGrace() time.Duration {
+	grace, err := time.ParseDuration(os.Getenv("ACCOUNT_DELETION_GRACE"))
+	if err != nil || grace < 0 {
+		return 0
+	}
+	return grace
+}
+
+// DeleteUser removes the user with their passkeys and sessions, and the personal data of their audit entries
+//
+// userId - the id of the user to delete
+func DeleteUser(userId string) error {
+	if err := InvalidateUserSessions(userId, nil); err != nil {
+		return err
+	}
+
+	db := databases.GetMongoDatabase()
+	if _, err := db.Collection("passkeys").DeleteMany(context.Background(), bson.M{"user_id": userId}); err != nil {
+		return err
+	}
+	if _, err := db.Collection("users").DeleteOne(context.Background(), bson.M{"id": userId}); err != nil {
+		return err
+	}
+	if err := anonymizeAuditLog(userId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// PurgeDeletedUsers deletes the users whose deletion grace period is over, it checks every hour
+//
+// It runs even when ACCOUNT_DELETION_GRACE is 0, users scheduled before the grace period was
+// turned off are still deleted
+func PurgeDeletedUsers() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for ; true; <-ticker.C {
+		cursor, err := databases.GetMongoDatabase().Collection("users").Find(context.Background(), bson.M{
+			"deletion_scheduled_at": bson.M{"$lte": time.Now()},
+		})
+		if err != nil {
+			log.Println("[Error] Couldn't find users to delete: \n", err)
+			continue
+		}
+
+		var users []databases.UserInfo
+		if err := cursor.All(context.Background(), &users); err != nil {
+			log.Println("[Error] Couldn't find users to delete: \n", err)
+			continue
+		}
+
+		for _, user := range users {
+			if err := DeleteUser(user.Id); err != nil {
+				log.Println("[Error] Couldn't delete user: \n", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireAdmin is a middleware that only lets requests with the ADMIN_API_KEY bearer token through,
+// the admin routes are disabled while ADMIN_API_KEY is empty
+func RequireAdmin(c *fiber.Ctx) error {
+	apiKey := os.Getenv("ADMIN_API_KEY")
+	token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+	if apiKey == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) != 1 {
+		return ErrorResponse(c, 401, "UNAUTHENTICATED", "Admin api key is invalid.")
+	}
+
+	return c.Next()
+}
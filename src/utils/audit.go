@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/x1xo/Auth/src/databases"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	AuditLogin             = "login"
+	AuditProviderLinked    = "provider_linked"
+	AuditProviderUnlinked  = "provider_unlinked"
+	AuditDeletionScheduled = "account_deletion_scheduled"
+	AuditDeletionCancelled = "account_deletion_cancelled"
+	AuditAccountDeleted    = "account_deleted"
+)
+
+// Audit saves an entry in the audit_log collection
+//
+// userId - the id of the user the action was made on
+// action - one of the Audit* constants
+// provider - the provider the action is about, can be empty
+func Audit(c *fiber.Ctx, userId, action, provider string) {
+	saveAuditEntry(databases.AuditEntry{
+		Id:        uuid.New().String(),
+		UserId:    userId,
+		Action:    action,
+		Provider:  provider,
+		IP:        c.IP(),
+		UserAgent: string(c.Context().UserAgent()),
+		CreatedAt: time.Now(),
+	})
+}
+
+// anonymizeAuditLog removes the ip addresses and user agents from the user's audit entries
+// and records the deletion without them, so only the anonymous history of the account is kept
+func anonymizeAuditLog(userId string) error {
+	_, err := databases.GetMongoDatabase().Collection("audit_log").UpdateMany(context.Background(), bson.M{"user_id": userId}, bson.M{
+		"$set": bson.M{"ip": "", "user_agent": ""},
+	})
+	if err != nil {
+		return err
+	}
+
+	saveAuditEntry(databases.AuditEntry{
+		Id:        uuid.New().String(),
+		UserId:    userId,
+		Action:    AuditAccountDeleted,
+		CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+// saveAuditEntry inserts the entry, a failure is only logged so it never blocks the action
+func saveAuditEntry(entry databases.AuditEntry) {
+	if _, err := databases.GetMongoDatabase().Collection("audit_log").InsertOne(context.Background(), &entry); err != nil {
+		log.Println("[Error] Couldn't save audit entry: \n", err)
+	}
+}
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/x1xo/Auth/src/databases"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// clientOriginsTTL is how long the client origins are cached, the admin routes
+// invalidate the cache right away so it only matters for other instances
+const clientOriginsTTL = time.Minute
+
+var (
+	clientOrigins          map[string]bool
+	clientOriginsExpiresAt time.Time
+	clientOriginsMutex     sync.RWMutex
+)
+
+// GetClient returns the client app registered in the clients collection
+//
+// clientId - the id of the client app
+//
+// returns the client and true, or false if no client has the id
+func GetClient(clientId string) (*databases.Client, bool) {
+	if clientId == "" {
+		return nil, false
+	}
+
+	var client databases.Client
+	err := databases.GetMongoDatabase().Collection("clients").FindOne(context.Background(), bson.M{"id": clientId}).Decode(&client)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("[Error] Couldn't find client: \n", err)
+		}
+		return nil, false
+	}
+
+	return &client, true
+}
+
+// VerifyClientSecret compares the secret with the client's secret hash in constant time
+func VerifyClientSecret(client *databases.Client, secret string) bool {
+	if client.SecretHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(client.SecretHash)) == 1
+}
+
+// HasRedirectURI reports whether the redirect uri is registered for the client, they must match exactly
+func HasRedirectURI(client *databases.Client, redirectURI string) bool {
+	for _, registered := range client.RedirectURIs {
+		if registered == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAllowedOrigin reports whether the origin is in ALLOWED_ORIGINS or the allowed origins of a client
+func IsAllowedOrigin(origin string) bool {
+	// Requests without an origin aren't cross-origin, and an empty ALLOWED_ORIGINS would match it
+	if origin == "" {
+		return false
+	}
+
+	for _, allowed := range strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",") {
+		if strings.TrimSpace(allowed) == origin {
+			return true
+		}
+	}
+
+	origins, err := getClientOrigins()
+	return err == nil && origins[origin]
+}
+
+// InvalidateClientOrigins drops the cached client origins after a client was changed
+func InvalidateClientOrigins() {
+	clientOriginsMutex.Lock()
+	clientOrigins = nil
+	clientOriginsMutex.Unlock()
+}
+
+// getClientOrigins returns the allowed origins of every client, the CORS check runs
+// on every request so they're cached for clientOriginsTTL
+func getClientOrigins() (map[string]bool, error) {
+	clientOriginsMutex.RLock()
+	origins, expiresAt := clientOrigins, clientOriginsExpiresAt
+	clientOriginsMutex.RUnlock()
+	if origins != nil && time.Now().Before(expiresAt) {
+		return origins, nil
+	}
+
+	cursor, err := databases.GetMongoDatabase().Collection("clients").Find(context.Background(), bson.M{}, options.Find().SetProjection(bson.M{"allowed_origins": 1}))
+	if err != nil {
+		log.Println("[Error] Couldn't load client origins: \n", err)
+		return nil, err
+	}
+
+	var clients []databases.Client
+	if err := cursor.All(context.Background(), &clients); err != nil {
+		log.Println("[Error] Couldn't load client origins: \n", err)
+		return nil, err
+	}
+
+	origins = map[string]bool{}
+	for _, client := range clients {
+		for _, origin := range client.AllowedOrigins {
+			origins[origin] = true
+		}
+	}
+
+	clientOriginsMutex.Lock()
+	clientOrigins, clientOriginsExpiresAt = origins, time.Now().Add(clientOriginsTTL)
+	clientOriginsMutex.Unlock()
+
+	return origins, nil
+}
+
+// SessionDuration returns how long the sessions of the client app last, logins without a
+// client and clients without a duration use SESSION_DURATION
+//
+// clientId - the id of the client app the user logs in to, can be empty
+func SessionDuration(clientId string) time.Duration {
+	if client, ok := GetClient(clientId); ok {
+		if duration, err := time.ParseDuration(client.SessionDuration); err == nil && duration > 0 {
+			return duration
+		}
+	}
+
+	duration, err := time.ParseDuration(os.Getenv("SESSION_DURATION"))
+	if err != nil {
+		duration = (time.Hour * 24) * 7
+	}
+	return duration
+}
+
+// LoginRedirect returns where the user is sent after logging in: the redirect_to of the login,
+// the first allowed origin of the client app or REDIRECT_URL
+func LoginRedirect(clientId, redirectTo string) string {
+	if redirectTo != "" {
+		return redirectTo
+	}
+	if client, ok := GetClient(clientId); ok && len(client.AllowedOrigins) > 0 {
+		return client.AllowedOrigins[0]
+	}
+	return os.Getenv("REDIRECT_URL")
+}
+
+// isClientRedirect reports whether the target is a redirect uri or on an allowed origin of the client
+func isClientRedirect(clientId, target string) bool {
+	client, ok := GetClient(clientId)
+	if !ok {
+		return false
+	}
+	if HasRedirectURI(client, target) {
+		return true
+	}
+
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	for _, origin := range client.AllowedOrigins {
+		if strings.EqualFold(origin, targetURL.Scheme+"://"+targetURL.Host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// CORS returns the cors middleware for ALLOWED_ORIGINS and the allowed origins of the client apps
+//
+// Origins that aren't allowed skip the middleware and get no CORS headers at all, the cors
+// middleware would answer them with "Access-Control-Allow-Origin: *" when AllowOrigins is empty
+func CORS() fiber.Handler {
+	return cors.New(cors.Config{
+		Next: func(c *fiber.Ctx) bool {
+			return !IsAllowedOrigin(c.Get(fiber.HeaderOrigin))
+		},
+		AllowHeaders:     "Origin,Content-Type,Accept,Content-Length,Accept-Language,Accept-Encoding,Connection,Access-Control-Allow-Origin",
+		AllowCredentials: true,
+		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
+		// Next already skipped the origins that aren't allowed, this echoes the origin instead of "*"
+		AllowOriginsFunc: func(origin string) bool { return true },
+	})
+}
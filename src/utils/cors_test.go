@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCORS(t *testing.T) {
+	t.Setenv("ALLOWED_ORIGINS", "https://app.example.com")
+
+	// Fill the client origins cache so the check doesn't need mongo
+	clientOriginsMutex.Lock()
+	clientOrigins, clientOriginsExpiresAt = map[string]bool{"https://client.example.com": true}, time.Now().Add(time.Hour)
+	clientOriginsMutex.Unlock()
+	t.Cleanup(InvalidateClientOrigins)
+
+	app := fiber.New()
+	app.Use(CORS())
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	tests := []struct {
+		origin string
+		method string
+		allow  string
+	}{
+		{"https://app.example.com", fiber.MethodGet, "https://app.example.com"},
+		{"https://app.example.com", fiber.MethodOptions, "https://app.example.com"},
+		{"https://client.example.com", fiber.MethodGet, "https://client.example.com"},
+		{"https://evil.example", fiber.MethodGet, ""},
+		{"https://evil.example", fiber.MethodOptions, ""},
+		{"", fiber.MethodGet, ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/", nil)
+		if test.origin != "" {
+			req.Header.Set(fiber.HeaderOrigin, test.origin)
+		}
+		req.Header.Set(fiber.HeaderAccessControlRequestMethod, fiber.MethodGet)
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s %q: %v", test.method, test.origin, err)
+		}
+
+		if allow := resp.Header.Get(fiber.HeaderAccessControlAllowOrigin); allow != test.allow {
+			t.Errorf("%s %q: Access-Control-Allow-Origin = %q, want %q", test.method, test.origin, allow, test.allow)
+		}
+		credentials := resp.Header.Get(fiber.HeaderAccessControlAllowCredentials)
+		if test.allow == "" && credentials != "" {
+			t.Errorf("%s %q: Access-Control-Allow-Credentials = %q, want none", test.method, test.origin, credentials)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/x1xo/Auth/src/databases"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MFACookie holds the pending MFA token between the first and the second login step
+const MFACookie = "mfa_session"
+
+// RequiresMFA returns true when the user has a second factor enabled
+// (an authenticator app or a registered passkey)
+func RequiresMFA(user *databases.UserInfo) bool {
+	if user.MFA.TOTPEnabled {
+		return true
+	}
+
+	passkeys, err := databases.GetMongoDatabase().Collection("passkeys").CountDocuments(context.Background(), bson.M{"user_id": user.Id})
+	return err != nil || passkeys > 0
+}
+
+// CreatePendingMFA saves a pending MFA session instead of issuing the real session,
+// it can only be used on the /mfa routes to complete the login
+//
+// userId - the user that completed the first login step
+// provider - the login method of the first step
+// clientId - the client app the user logs in to, can be empty
+// redirectTo - where to send the user after the second step
+//
+// returns the pending MFA token or an error
+func CreatePendingMFA(c *fiber.Ctx, userId, provider, clientId, redirectTo string) (string, error) {
+	token, err := RandomId(32)
+	if err != nil {
+		return "", err
+	}
+
+	pending, err := json.Marshal(databases.PendingMFA{
+		UserId:     userId,
+		Provider:   provider,
+		ClientId:   clientId,
+		RedirectTo: redirectTo,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := databases.GetRedis().Set(context.Background(), "mfa_pending_"+HashToken(token), pending, time.Minute*5).Err(); err != nil {
+		return "", err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     MFACookie,
+		Value:    token,
+		Path:     "/mfa",
+		Expires:  time.Now().Add(time.Minute * 5),
+		HTTPOnly: true,
+		Secure:   os.Getenv("ENVIRONMENT") == "production",
+	})
+
+	return token, nil
+}
+
+// MFARedirect sends the user to the MFA_URL page after the first login step,
+// or responds with json when it's not set
+func MFARedirect(c *fiber.Ctx) error {
+	if mfaURL := os.Getenv("MFA_URL"); mfaURL != "" {
+		return c.Redirect(mfaURL)
+	}
+
+	return c.Status(200).JSON(fiber.Map{
+		"mfa_required": true,
+	})
+}
+
+// GetPendingMFA returns the pending MFA session of the token
+func GetPendingMFA(token string) (*databases.PendingMFA, error) {
+	result, err := databases.GetRedis().Get(context.Background(), "mfa_pending_"+HashToken(token)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending databases.PendingMFA
+	if err := json.Unmarshal([]byte(result), &pending); err != nil {
+		return nil, err
+	}
+
+	return &pending, nil
+}
+
+// DeletePendingMFA removes the pending MFA session once the second step is completed
+func DeletePendingMFA(c *fiber.Ctx, token string) {
+	databases.GetRedis().Del(context.Background(), "mfa_pending_"+HashToken(token))
+	c.Cookie(&fiber.Cookie{
+		Name:    MFACookie,
+		Path:    "/mfa",
+		Expires: time.Unix(0, 0),
+	})
+}
+
+// UseTOTPStep marks the time step of a TOTP code as used, so the same code can't be replayed
+//
+// returns false if the code was already used
+func UseTOTPStep(userId string, step uint64) bool {
+	used, err := databases.GetRedis().SetNX(context.Background(), fmt.Sprintf("totp_used_%s_%d", userId, step), 1, time.Minute*2).Result()
+	return err == nil && used
+}
+
+// GenerateRecoveryCodes returns 10 single-use recovery codes (xxxxx-xxxxx) and their hashes
+func GenerateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 10)
+	hashes := make([]string, 10)
+
+	for i := range codes {
+		code, err := RandomId(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the hash of the recovery code, ignoring dashes, spaces and case
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashToken(code)
+}
+
+// CheckRateLimit counts the attempt and returns false when the limit of the window is reached
+//
+// key - the rate limit key (e.g. mfa_attempts_<userId>)
+// limit - the allowed attempts in the window
+// window - the duration of the window, starting from the first attempt
+func CheckRateLimit(key string, limit int64, window time.Duration) bool {
+	redis := databases.GetRedis()
+
+	attempts, err := redis.Incr(context.Background(), "rate_limit_"+key).Result()
+	if err != nil {
+		return false
+	}
+	if attempts == 1 {
+		redis.Expire(context.Background(), "rate_limit_"+key, window)
+	}
+
+	return attempts <= limit
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2Params are the argon2id parameters, configured with ARGON2_MEMORY (KiB),
+// ARGON2_ITERATIONS and ARGON2_PARALLELISM
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// GetArgon2Params returns the argon2id parameters from the environment
+func GetArgon2Params() Argon2Params {
+	params := Argon2Params{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+
+	if memory, err := strconv.ParseUint(os.Getenv("ARGON2_MEMORY"), 10, 32); err == nil && memory > 0 {
+		params.Memory = uint32(memory)
+	}
+	if iterations, err := strconv.ParseUint(os.Getenv("ARGON2_ITERATIONS"), 10, 32); err == nil && iterations > 0 {
+		params.Iterations = uint32(iterations)
+	}
+	if parallelism, err := strconv.ParseUint(os.Getenv("ARGON2_PARALLELISM"), 10, 8); err == nil && parallelism > 0 {
+		params.Parallelism = uint8(parallelism)
+	}
+
+	return params
+}
+
+// HashPassword hashes the password with argon2id
+//
+// password - the plain text password
+//
+// returns the hash in the PHC format ($argon2id$v=19$m=...,t=...,p=...$salt$key) or an error
+func HashPassword(password string) (string, error) {
+	params := GetArgon2Params()
+
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// VerifyPassword compares the password with the argon2id hash
+//
+// password - the plain text password
+// encodedHash - the hash returned from HashPassword
+//
+// returns whether the password matches, whether the hash was created with
+// different parameters than the current ones and should be replaced, or an error
+func VerifyPassword(password, encodedHash string) (bool, bool, error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false, errors.New("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false, err
+	}
+
+	var params Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return false, false, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, err
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false, nil
+	}
+
+	current := GetArgon2Params()
+	needsRehash := version != argon2.Version ||
+		params.Memory != current.Memory ||
+		params.Iterations != current.Iterations ||
+		params.Parallelism != current.Parallelism ||
+		params.KeyLength != current.KeyLength
+
+	return true, needsRehash, nil
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// IsAllowedRedirect checks the redirect target against REDIRECT_ALLOWLIST and the client app
+//
+// REDIRECT_ALLOWLIST is a comma separated list of origins with an optional path pattern:
+// "https://app.example.com" allows every path, "https://app.example.com/settings/*" allows
+// one path segment under /settings and "https://app.example.com/docs/**" allows everything under /docs
+//
+// target - the absolute url to redirect to
+// clientId - the client app the login was started for, its redirect uris and allowed origins are allowed
+//
+// returns true if the target matches an entry of the allowlist or is the service's own /authorize
+func IsAllowedRedirect(target, clientId string) bool {
+	// Apps using the service as OpenID Connect provider send the user to log in and back to /authorize
+	if strings.HasPrefix(target, IssuerURL()+"/authorize?") {
+		return true
+	}
+
+	targetURL, err := url.Parse(target)
+	if err != nil || targetURL.User != nil || targetURL.Host == "" {
+		return false
+	}
+	if targetURL.Scheme != "https" && targetURL.Scheme != "http" {
+		return false
+	}
+
+	if clientId != "" && isClientRedirect(clientId, target) {
+		return true
+	}
+
+	targetPath := path.Clean("/" + targetURL.Path)
+
+	for _, entry := range strings.Split(os.Getenv("REDIRECT_ALLOWLIST"), ",") {
+		entryURL, err := url.Parse(strings.TrimSpace(entry))
+		if err != nil || entryURL.Host == "" {
+			continue
+		}
+		if entryURL.Scheme != targetURL.Scheme || !strings.EqualFold(entryURL.Host, targetURL.Host) {
+			continue
+		}
+
+		if matchRedirectPath(entryURL.Path, targetPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchRedirectPath matches the path against the allowlist pattern
+func matchRedirectPath(pattern, targetPath string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return targetPath == prefix || strings.HasPrefix(targetPath, prefix+"/")
+	}
+
+	matched, err := path.Match(pattern, targetPath)
+	return err == nil && matched
+}
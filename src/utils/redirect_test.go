@@ -0,0 +1,97 @@
+package utils
+
+import "testing"
+
+func TestIsAllowedRedirect(t *testing.T) {
+	t.Setenv("REDIRECT_ALLOWLIST", "https://app.example.com, https://site.example.com/settings/*, https://site.example.com/docs/**")
+	t.Setenv("ISSUER_URL", "")
+	t.Setenv("CALLBACK_URL", "https://auth.example.com/")
+
+	tests := []struct {
+		name   string
+		target string
+		ok     bool
+	}{
+		{"allowed origin", "https://app.example.com/dashboard", true},
+		{"host is case insensitive", "https://APP.example.com/", true},
+		{"same host over http", "http://app.example.com/dashboard", false},
+		{"other scheme", "javascript://app.example.com/%0aalert(1)", false},
+		{"other host", "https://evil.com/", false},
+		{"allowed host as subdomain", "https://app.example.com.evil.com/", false},
+		{"userinfo with the allowed host", "https://app.example.com@evil.com", false},
+		{"userinfo on the allowed host", "https://user@app.example.com/", false},
+		{"relative url", "/dashboard", false},
+		{"protocol relative url", "//evil.com/", false},
+
+		{"one segment under /settings", "https://site.example.com/settings/profile", true},
+		{"nested segment under /settings", "https://site.example.com/settings/profile/edit", false},
+		{"pattern prefix itself", "https://site.example.com/settings", false},
+		{"traversal out of /settings", "https://site.example.com/settings/../admin", false},
+		{"encoded traversal out of /settings", "https://site.example.com/settings/%2e%2e/admin", false},
+		{"path outside the patterns", "https://site.example.com/admin", false},
+
+		{"/** prefix", "https://site.example.com/docs", true},
+		{"/** nested path", "https://site.example.com/docs/guide/install", true},
+		{"/** sibling with the same prefix", "https://site.example.com/docsx", false},
+		{"traversal out of /docs", "https://site.example.com/docs/../admin", false},
+
+		{"authorize of the issuer", "https://auth.example.com/authorize?client_id=app", true},
+		{"authorize without query", "https://auth.example.com/authorize", false},
+		{"authorize on a look-alike host", "https://auth.example.com.evil.com/authorize?client_id=app", false},
+		{"other path of the issuer", "https://auth.example.com/userinfo?client_id=app", false},
+	}
+
+	for _, test := range tests {
+		if ok := IsAllowedRedirect(test.target, ""); ok != test.ok {
+			t.Errorf("%s: IsAllowedRedirect(%q) = %v, want %v", test.name, test.target, ok, test.ok)
+		}
+	}
+}
+
+func TestIsAllowedRedirectWithoutIssuer(t *testing.T) {
+	t.Setenv("REDIRECT_ALLOWLIST", "")
+	t.Setenv("ISSUER_URL", "")
+	t.Setenv("CALLBACK_URL", "")
+
+	// Without any issuer url the shortcut only matches the service's own relative /authorize
+	tests := []struct {
+		target string
+		ok     bool
+	}{
+		{"/authorize?client_id=app", true},
+		{"https://evil.com/authorize?client_id=app", false},
+		{"//evil.com/authorize?client_id=app", false},
+	}
+
+	for _, test := range tests {
+		if ok := IsAllowedRedirect(test.target, ""); ok != test.ok {
+			t.Errorf("IsAllowedRedirect(%q) = %v, want %v", test.target, ok, test.ok)
+		}
+	}
+}
+
+func TestMatchRedirectPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		ok      bool
+	}{
+		{"", "/anything/at/all", true},
+		{"/settings/*", "/settings/profile", true},
+		{"/settings/*", "/settings/profile/edit", false},
+		{"/settings/*", "/settings", false},
+		{"/docs/**", "/docs", true},
+		{"/docs/**", "/docs/a/b/c", true},
+		{"/docs/**", "/docsx", false},
+		{"/docs/**", "/doc", false},
+		{"/exact", "/exact", true},
+		{"/exact", "/exact/more", false},
+		{"/[", "/[", false},
+	}
+
+	for _, test := range tests {
+		if ok := matchRedirectPath(test.pattern, test.path); ok != test.ok {
+			t.Errorf("matchRedirectPath(%q, %q) = %v, want %v", test.pattern, test.path, ok, test.ok)
+		}
+	}
+}
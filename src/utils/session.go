@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/x1xo/Auth/src/databases"
+)
+
+// ErrInvalidSession is returned by GetSession when the token points to a record that isn't a session
+var ErrInvalidSession = errors.New("record is not a session")
+
+// GetSession returns the session saved in redis for the token
+//
+// token - the session token
+//
+// returns *databases.UserSession or an error if the session doesn't exist
+func GetSession(token string) (*databases.UserSession, error) {
+	result, err := databases.GetRedis().Get(context.Background(), token).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var session databases.UserSession
+	if err := json.Unmarshal([]byte(result), &session); err != nil {
+		return nil, err
+	}
+	// Other records (login states, ...) are saved under random keys too, a session
+	// always has the token it's saved under and the user it belongs to
+	if session.Token != token || session.UserId == "" {
+		return nil, ErrInvalidSession
+	}
+
+	return &session, nil
+}
+
+// RequireSession is a middleware that rejects requests without a valid session,
+// the session is available to the next handlers with CurrentSession
+func RequireSession(c *fiber.Ctx) error {
+	token := GetUserToken(c)
+	if token == "" {
+		return ErrorResponse(c, 401, "UNAUTHENTICATED", "Session token couldn't be found in header or cookie")
+	}
+
+	session, err := GetSession(token)
+	if err != nil {
+		return ErrorResponse(c, 401, "UNAUTHENTICATED", "Session token is invalid.")
+	}
+
+	c.Locals("session", session)
+	return c.Next()
+}
+
+// CurrentSession returns the session set by RequireSession
+func CurrentSession(c *fiber.Ctx) *databases.UserSession {
+	session, _ := c.Locals("session").(*databases.UserSession)
+	return session
+}
+
+// InvalidateUserSessions deletes the user's sessions from redis
+//
+// userId - the user whose sessions are deleted
+// match - only the sessions it returns true for are deleted, nil deletes every session
+func InvalidateUserSessions(userId string, match func(session *databases.UserSession) bool) error {
+	redis := databases.GetRedis()
+
+	sessionIds, err := redis.Keys(context.Background(), userId+"_*").Result()
+	if err != nil || len(sessionIds) == 0 {
+		return err
+	}
+
+	sessionTokens, err := redis.MGet(context.Background(), sessionIds...).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := redis.Pipeline()
+	for i, sessionToken := range sessionTokens {
+		// The session expired after the keys were listed
+		token, ok := sessionToken.(string)
+		if !ok {
+			continue
+		}
+		if match != nil {
+			session, err := GetSession(token)
+			if err != nil || !match(session) {
+				continue
+			}
+		}
+		pipe.Del(context.Background(), token)
+		pipe.Del(context.Background(), sessionIds[i])
+	}
+
+	_, err = pipe.Exec(context.Background())
+	return err
+}
+
+// ListUserSessions returns the user's active sessions without their tokens
+//
+// userId - the user whose sessions are returned
+func ListUserSessions(userId string) ([]databases.UserSession, error) {
+	redis := databases.GetRedis()
+
+	sessionIds, err := redis.Keys(context.Background(), userId+"_*").Result()
+	if err != nil || len(sessionIds) == 0 {
+		return []databases.UserSession{}, err
+	}
+
+	sessionTokens, err := redis.MGet(context.Background(), sessionIds...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []databases.UserSession{}
+	for _, sessionToken := range sessionTokens {
+		token, ok := sessionToken.(string)
+		if !ok {
+			continue
+		}
+		session, err := GetSession(token)
+		if err != nil {
+			continue
+		}
+		session.Token = ""
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is the RSA key the service signs its tokens with
+type SigningKey struct {
+	Id         string
+	PrivateKey *rsa.PrivateKey
+}
+
+var (
+	signingKey     *SigningKey
+	signingKeyErr  error
+	signingKeyOnce sync.Once
+)
+
+// GetSigningKey returns the key loaded from the PEM file at SIGNING_KEY_PATH. Without it a
+// key is generated on startup, tokens signed with it stop being valid after a restart
+func GetSigningKey() (*SigningKey, error) {
+	signingKeyOnce.Do(func() {
+		var privateKey *rsa.PrivateKey
+		if keyPath := os.Getenv("SIGNING_KEY_PATH"); keyPath != "" {
+			privateKey, signingKeyErr = readSigningKey(keyPath)
+		} else {
+			log.Println("[Warning] SIGNING_KEY_PATH is not set, tokens are signed with a temporary key")
+			privateKey, signingKeyErr = rsa.GenerateKey(rand.Reader, 2048)
+		}
+		if signingKeyErr != nil {
+			return
+		}
+
+		// The key id is derived from the public key, so it only changes with the key
+		publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+		if err != nil {
+			signingKeyErr = err
+			return
+		}
+		hash := sha256.Sum256(publicKey)
+
+		signingKey = &SigningKey{
+			Id:         base64.RawURLEncoding.EncodeToString(hash[:16]),
+			PrivateKey: privateKey,
+		}
+	})
+
+	return signingKey, signingKeyErr
+}
+
+// readSigningKey reads a PKCS#1 or PKCS#8 RSA private key from the PEM file
+func readSigningKey(keyPath string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("signing key is not a pem file")
+	}
+
+	if privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return privateKey, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an rsa key")
+	}
+
+	return privateKey, nil
+}
+
+// SignToken signs the claims as a RS256 JWT with the signing key
+//
+// claims - the claims of the token
+// tokenType - the typ header, so one kind of token can't be used as another
+//
+// returns the signed token or an error
+func SignToken(claims jwt.Claims, tokenType string) (string, error) {
+	key, err := GetSigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.Id
+	token.Header["typ"] = tokenType
+	return token.SignedString(key.PrivateKey)
+}
+
+// JWKS returns the public signing key as a JSON Web Key Set
+func JWKS() (map[string]interface{}, error) {
+	key, err := GetSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey := key.PrivateKey.PublicKey
+	return map[string]interface{}{
+		"keys": []map[string]interface{}{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": key.Id,
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}},
+	}, nil
+}
+
+// IssuerURL returns the url the service issues tokens as, ISSUER_URL or CALLBACK_URL
+func IssuerURL() string {
+	issuer := os.Getenv("ISSUER_URL")
+	if issuer == "" {
+		issuer = os.Getenv("CALLBACK_URL")
+	}
+	return strings.TrimSuffix(issuer, "/")
+}
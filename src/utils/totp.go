@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const totpPeriod = 30
+const totpDigits = 6
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random base32 encoded 160bit secret
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI returns the otpauth:// uri that authenticator apps read from the QR code
+//
+// secret - the base32 encoded secret
+// account - the user's email or username
+// issuer - the name shown in the authenticator app
+func TOTPURI(secret, account, issuer string) string {
+	return "otpauth://totp/" + url.PathEscape(issuer) + ":" + url.PathEscape(account) + "?" + url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}.Encode()
+}
+
+// TOTPCode returns the RFC 6238 code of the secret for the time step counter
+func TOTPCode(secret string, counter uint64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation (RFC 4226 section 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// ValidateTOTP checks the code against the current time step and one step
+// before and after it to allow for clock drift
+//
+// returns the matched time step, used to reject the same code twice, or false
+func ValidateTOTP(secret, code string) (uint64, bool) {
+	return validateTOTPAt(secret, code, time.Now())
+}
+
+// validateTOTPAt is ValidateTOTP at the given time
+func validateTOTPAt(secret, code string, now time.Time) (uint64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	counter := uint64(now.Unix() / totpPeriod)
+	for _, step := range []uint64{counter - 1, counter, counter + 1} {
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
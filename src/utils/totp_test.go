@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// The RFC 6238 Appendix B SHA-1 seed "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// The Appendix B values are 8 digits, these are their last 6
+var rfcVectors = []struct {
+	time int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCode(t *testing.T) {
+	for _, vector := range rfcVectors {
+		code, err := TOTPCode(rfcSecret, uint64(vector.time/totpPeriod))
+		if err != nil {
+			t.Fatalf("TOTPCode(%d) returned an error: %v", vector.time, err)
+		}
+		if code != vector.code {
+			t.Errorf("TOTPCode(%d) = %s, want %s", vector.time, code, vector.code)
+		}
+	}
+}
+
+func TestTOTPCodeLowercaseSecret(t *testing.T) {
+	code, err := TOTPCode("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1)
+	if err != nil || code != "287082" {
+		t.Errorf("TOTPCode with a lowercase secret = %s, %v, want 287082", code, err)
+	}
+}
+
+func TestTOTPCodeInvalidSecret(t *testing.T) {
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("TOTPCode accepted a secret that isn't base32")
+	}
+}
+
+func TestValidateTOTPVectors(t *testing.T) {
+	for _, vector := range rfcVectors {
+		step, ok := validateTOTPAt(rfcSecret, vector.code, time.Unix(vector.time, 0))
+		if !ok {
+			t.Errorf("code %s was rejected at %d", vector.code, vector.time)
+			continue
+		}
+		if want := uint64(vector.time / totpPeriod); step != want {
+			t.Errorf("code %s matched step %d at %d, want %d", vector.code, step, vector.time, want)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	// 1111111111 is step 37037037, the code of the step is 050471
+	const step = 37037037
+	code, _ := TOTPCode(rfcSecret, step)
+
+	tests := []struct {
+		name string
+		time int64
+		ok   bool
+	}{
+		{"first second of the step", step * totpPeriod, true},
+		{"last second of the step", step*totpPeriod + totpPeriod - 1, true},
+		{"one step later", (step + 1) * totpPeriod, true},
+		{"last second of one step later", (step+1)*totpPeriod + totpPeriod - 1, true},
+		{"two steps later", (step + 2) * totpPeriod, false},
+		{"last second of one step earlier", step*totpPeriod - 1, true},
+		{"first second of one step earlier", (step - 1) * totpPeriod, true},
+		{"last second of two steps earlier", (step-1)*totpPeriod - 1, false},
+	}
+
+	for _, test := range tests {
+		matched, ok := validateTOTPAt(rfcSecret, code, time.Unix(test.time, 0))
+		if ok != test.ok {
+			t.Errorf("%s: ok = %v, want %v", test.name, ok, test.ok)
+		}
+		if ok && matched != step {
+			t.Errorf("%s: matched step %d, want %d", test.name, matched, step)
+		}
+	}
+}
+
+func TestValidateTOTPRejectsMalformedCodes(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	for _, code := range []string{"", "05047", "0504710", "50471 ", "abcdef"} {
+		if _, ok := validateTOTPAt(rfcSecret, code, now); ok {
+			t.Errorf("code %q was accepted", code)
+		}
+	}
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	if os.Getenv("REDIS_URI") == "" {
+		t.Skip("REDIS_URI is not set")
+	}
+
+	userId := "totp_test_" + time.Now().Format("20060102150405.000000000")
+	if !UseTOTPStep(userId, 1) {
+		t.Fatal("first use of the step was rejected")
+	}
+	if UseTOTPStep(userId, 1) {
+		t.Error("the same step was accepted twice")
+	}
+	if !UseTOTPStep(userId, 2) {
+		t.Error("the next step was rejected after the previous one was used")
+	}
+}
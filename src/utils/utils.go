@@ -3,10 +3,12 @@ package utils
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -68,6 +70,42 @@ func CreateSession(userId, userAgent, ipAddress, provider string, expiresAt time
 	return &userSession, nil
 }
 
+// HashToken returns the hex encoded sha256 hash of the token,
+// used for secrets that are only stored to be compared later
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// IssueSession creates a session for the user and sets the session cookie
+//
+// userId - the user's id for the session
+// provider - the login method (github, password, ...)
+// clientId - the client app the user logs in to, its session duration is used when set
+//
+// returns *databases.UserSession or an error
+func IssueSession(c *fiber.Ctx, userId, provider, clientId string) (*databases.UserSession, error) {
+	session, err := CreateSession(userId, string(c.Context().UserAgent()), c.IP(), provider, SessionDuration(clientId))
+	if err != nil {
+		return nil, err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "session",
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  time.Now().Add(time.Hour * 3),
+		HTTPOnly: true,
+		Secure:   os.Getenv("ENVIRONMENT") == "production",
+	})
+
+	c.Set("Authorization", "Bearer "+session.Token)
+
+	Audit(c, userId, AuditLogin, provider)
+
+	return session, nil
+}
+
 // GetIPInfo returns information about the users ip address
 //
 // ipAddress - the users ip address
@@ -125,3 +163,36 @@ func GetUserToken(c *fiber.Ctx) string {
 	}
 	return token
 }
+
+// ErrorResponse sends the error in the format used by every route
+//
+// status - the http status code
+// code - the error code (INVALID_STATE, INTERNAL_SERVER_ERROR, ...)
+// message - the human readable message
+func ErrorResponse(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(fiber.Map{
+		"error": fiber.Map{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
+
+// LoginStateCookie is the pre-auth cookie that binds the oAuth state to the browser
+const LoginStateCookie = "login_state"
+
+// ErrorRedirect redirects the user to ERROR_REDIRECT_URL with the error code,
+// or responds with the error json when it's not set. It's used on routes
+// the user opens in the browser (callbacks, email links)
+func ErrorRedirect(c *fiber.Ctx, status int, code, message string) error {
+	errorURL, err := url.Parse(os.Getenv("ERROR_REDIRECT_URL"))
+	if err != nil || errorURL.Host == "" {
+		return ErrorResponse(c, status, code, message)
+	}
+
+	query := errorURL.Query()
+	query.Set("error", code)
+	errorURL.RawQuery = query.Encode()
+
+	return c.Redirect(errorURL.String())
+}
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/x1xo/Auth/src/databases"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var webAuthn *webauthn.WebAuthn
+
+// GetWebAuthn returns the relying party configured with WEBAUTHN_RP_ID,
+// WEBAUTHN_RP_NAME and WEBAUTHN_RP_ORIGINS
+func GetWebAuthn() (*webauthn.WebAuthn, error) {
+	if webAuthn == nil {
+		rpId := os.Getenv("WEBAUTHN_RP_ID")
+		if rpId == "" {
+			callbackURL, err := url.Parse(os.Getenv("CALLBACK_URL"))
+			if err == nil {
+				rpId = callbackURL.Hostname()
+			}
+		}
+
+		rpName := os.Getenv("WEBAUTHN_RP_NAME")
+		if rpName == "" {
+			rpName = "Auth"
+		}
+
+		origins := os.Getenv("WEBAUTHN_RP_ORIGINS")
+		if origins == "" {
+			origins = os.Getenv("ALLOWED_ORIGINS")
+		}
+
+		var rpOrigins []string
+		for _, origin := range strings.Split(origins, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				rpOrigins = append(rpOrigins, origin)
+			}
+		}
+
+		w, err := webauthn.New(&webauthn.Config{
+			RPID:          rpId,
+			RPDisplayName: rpName,
+			RPOrigins:     rpOrigins,
+		})
+		if err != nil {
+			return nil, err
+		}
+		webAuthn = w
+	}
+
+	return webAuthn, nil
+}
+
+// WebAuthnUser adapts databases.UserInfo and its passkeys to webauthn.User
+type WebAuthnUser struct {
+	User     *databases.UserInfo
+	Passkeys []databases.Passkey
+}
+
+// LoadWebAuthnUser returns the user with its passkeys
+func LoadWebAuthnUser(userId string) (*WebAuthnUser, error) {
+	db := databases.GetMongoDatabase()
+
+	var user databases.UserInfo
+	if err := db.Collection("users").FindOne(context.Background(), bson.M{"id": userId}).Decode(&user); err != nil {
+		return nil, err
+	}
+
+	passkeys, err := GetPasskeys(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnUser{User: &user, Passkeys: passkeys}, nil
+}
+
+// GetPasskeys returns the passkeys registered by the user
+func GetPasskeys(userId string) ([]databases.Passkey, error) {
+	cursor, err := databases.GetMongoDatabase().Collection("passkeys").Find(context.Background(), bson.M{"user_id": userId})
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys := []databases.Passkey{}
+	if err := cursor.All(context.Background(), &passkeys); err != nil {
+		return nil, err
+	}
+
+	return passkeys, nil
+}
+
+func (u *WebAuthnUser) WebAuthnID() []byte {
+	return []byte(u.User.Id)
+}
+
+func (u *WebAuthnUser) WebAuthnName() string {
+	if u.User.Email != "" {
+		return u.User.Email
+	}
+	return u.User.Username
+}
+
+func (u *WebAuthnUser) WebAuthnDisplayName() string {
+	return u.User.Username
+}
+
+func (u *WebAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.Passkeys))
+	for _, passkey := range u.Passkeys {
+		credentials = append(credentials, passkey.Credential)
+	}
+	return credentials
+}
+
+func (u *WebAuthnUser) WebAuthnIcon() string {
+	return ""
+}